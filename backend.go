@@ -16,8 +16,45 @@ type Backend interface {
 	Refresh() ([]*flags2.Flag2, time.Time, error)
 }
 
+// ValidationMode controls what a JSON backend does with invalid flag
+// definitions, as reported by flags2.JSONFormat2.Validate.
+type ValidationMode int
+
+const (
+	// ValidationOff loads documents without validating them. Problems with
+	// a flag are reported when it is evaluated.
+	ValidationOff ValidationMode = iota
+	// ValidationLenient drops invalid flags, and loads the rest.
+	ValidationLenient
+	// ValidationStrict fails to load documents with any problems, so that
+	// the previous flags are kept.
+	ValidationStrict
+)
+
+// JSONOption configures a backend created by BackendFromJSONFile2.
+type JSONOption func(b *jsonFileBackend2)
+
+// JSONValidation sets how the backend handles invalid flags. By default,
+// they are not validated.
+func JSONValidation(mode ValidationMode) JSONOption {
+	return func(b *jsonFileBackend2) {
+		b.validation = mode
+	}
+}
+
+// JSONValidationCallback registers a callback to execute with the problems
+// found in each document that is validated, including those that are loaded
+// regardless.
+func JSONValidationCallback(cb func(errs flags2.ValidationErrors)) JSONOption {
+	return func(b *jsonFileBackend2) {
+		b.validationCB = cb
+	}
+}
+
 type jsonFileBackend2 struct {
-	filename string
+	filename     string
+	validation   ValidationMode
+	validationCB func(errs flags2.ValidationErrors)
 }
 
 func readFile(file string, parse func(io.Reader) ([]*flags2.Flag2, time.Time, error)) ([]*flags2.Flag2, time.Time, error) {
@@ -31,7 +68,7 @@ func readFile(file string, parse func(io.Reader) ([]*flags2.Flag2, time.Time, er
 }
 
 func (b jsonFileBackend2) Refresh() ([]*flags2.Flag2, time.Time, error) {
-	flags, updated, err := readFile(b.filename, parseFlagsJSON2)
+	flags, updated, err := readFile(b.filename, b.parse)
 	if updated != time.Unix(0, 0) {
 		return flags, updated, err
 	}
@@ -43,7 +80,15 @@ func (b jsonFileBackend2) Refresh() ([]*flags2.Flag2, time.Time, error) {
 	return flags, fileInfo.ModTime(), nil
 }
 
+func (b jsonFileBackend2) parse(r io.Reader) ([]*flags2.Flag2, time.Time, error) {
+	return parseFlagsJSON2Validated(r, b.validation, b.validationCB)
+}
+
 func parseFlagsJSON2(r io.Reader) ([]*flags2.Flag2, time.Time, error) {
+	return parseFlagsJSON2Validated(r, ValidationOff, nil)
+}
+
+func parseFlagsJSON2Validated(r io.Reader, mode ValidationMode, cb func(errs flags2.ValidationErrors)) ([]*flags2.Flag2, time.Time, error) {
 	dec := json.NewDecoder(r)
 	var v flags2.JSONFormat2
 	err := dec.Decode(&v)
@@ -51,15 +96,34 @@ func parseFlagsJSON2(r io.Reader) ([]*flags2.Flag2, time.Time, error) {
 		return nil, time.Time{}, err
 	}
 
-	flags := make([]*flags2.Flag2, len(v.Flags))
+	var invalid map[int]bool
+	if mode != ValidationOff {
+		if errs := v.Validate(); len(errs) > 0 {
+			if cb != nil {
+				cb(errs)
+			}
+			if mode == ValidationStrict {
+				return nil, time.Time{}, errs
+			}
+			invalid = errs.InvalidFlags()
+		}
+	}
+
+	flags := make([]*flags2.Flag2, 0, len(v.Flags))
 	for i, f := range v.Flags {
-		flags[i] = f
+		if !invalid[i] {
+			flags = append(flags, f)
+		}
 	}
 
 	return flags, time.Unix(int64(v.Updated), 0), nil
 }
 
 // BackendFromJSONFile2 creates a v2 backend powered by a JSON file
-func BackendFromJSONFile2(filename string) Backend {
-	return jsonFileBackend2{filename}
+func BackendFromJSONFile2(filename string, opts ...JSONOption) Backend {
+	b := jsonFileBackend2{filename: filename}
+	for _, opt := range opts {
+		opt(&b)
+	}
+	return b
 }
@@ -1,12 +1,18 @@
 package goforit
 
 import (
-	"github.com/stripe/goforit/flags2"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stripe/goforit/flags2"
 )
 
 func TestParseFlagsJSON(t *testing.T) {
@@ -27,6 +33,7 @@ func TestParseFlagsJSON(t *testing.T) {
 			Expected: []*flags2.Flag2{
 				{
 					Name:  "off_flag",
+					ID:    "ff_1",
 					Seed:  "seed_1",
 					Rules: []flags2.Rule2{},
 				},
@@ -65,6 +72,7 @@ func TestParseFlagsJSON(t *testing.T) {
 				},
 				{
 					Name: "flag5",
+					ID:   "ff_5",
 					Seed: "seed_1",
 					Rules: []flags2.Rule2{
 						{
@@ -140,6 +148,39 @@ func TestMultipleDefinitions(t *testing.T) {
 	assert.Equal(t, expected, flagHolder.flag)
 }
 
+func TestDuplicatePolicy(t *testing.T) {
+	t.Parallel()
+
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_multiple_definitions.json"))
+	percent := func(g *goforit) float64 {
+		holder, ok := g.flags.Get("go.sun.money")
+		require.True(t, ok)
+		return holder.flag.Rules[0].Percent
+	}
+
+	g, buf := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	assert.Equal(t, 0.7, percent(g))
+	g.RefreshFlags(backend)
+	assert.Equal(t, int64(2), g.getStats().(*mockStatsd).getCountValue(duplicatesMetricName))
+	// Only logged once, since the duplicates didn't change.
+	assert.Equal(t, 1, strings.Count(buf.String(), "\n"))
+	assert.Contains(t, buf.String(), `keeping the last: "go.sun.money" at index 0 and index 3`)
+
+	g2, _ := testGoforit(0, backend, stalenessCheckInterval, WithDuplicatePolicy(DuplicateFirstWins))
+	defer func() { _ = g2.Close() }()
+	assert.Equal(t, 0.5, percent(g2))
+	_, ok := g2.flags.Get("flag5")
+	assert.True(t, ok)
+
+	g3, _ := testGoforit(0, BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json")), stalenessCheckInterval,
+		WithDuplicatePolicy(DuplicateReject))
+	defer func() { _ = g3.Close() }()
+	err := g3.TryRefreshFlags(backend)
+	assert.ErrorContains(t, err, `flags are defined more than once: "go.sun.money" at index 0 and index 3`)
+	assert.Equal(t, float64(0), percent(g3))
+}
+
 func TestTimestampFallback(t *testing.T) {
 	backend := jsonFileBackend2{
 		filename: filepath.Join("testdata", "flags2_example.json"),
@@ -158,3 +199,200 @@ func TestTimestampFallback(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, info.ModTime(), updated)
 }
+
+// staticBackend returns fixed flags, or a fixed error.
+type staticBackend struct {
+	flags   []*flags2.Flag2
+	updated time.Time
+	err     error
+}
+
+func (b *staticBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
+	if b.err != nil {
+		return nil, time.Time{}, b.err
+	}
+	return b.flags, b.updated, nil
+}
+
+func onFlag(name string) *flags2.Flag2 {
+	return &flags2.Flag2{Name: name, Rules: []flags2.Rule2{{HashBy: flags2.HashByRandom, Percent: flags2.PercentOn}}}
+}
+
+func offFlag(name string) *flags2.Flag2 {
+	return &flags2.Flag2{Name: name}
+}
+
+func TestCompositeBackend(t *testing.T) {
+	t.Parallel()
+
+	older := time.Unix(1000, 0)
+	newer := time.Unix(2000, 0)
+	overrides := &staticBackend{flags: []*flags2.Flag2{onFlag("a")}, updated: newer}
+	fleet := &staticBackend{flags: []*flags2.Flag2{offFlag("a"), offFlag("b")}, updated: older}
+	defaults := &staticBackend{flags: []*flags2.Flag2{onFlag("b"), onFlag("c")}}
+
+	backend := NewCompositeBackend([]Backend{overrides, fleet, defaults})
+	flags, updated, err := backend.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, []*flags2.Flag2{onFlag("a"), offFlag("b"), onFlag("c")}, flags)
+	assert.Equal(t, older, updated)
+
+	_, updated, err = NewCompositeBackend([]Backend{overrides, fleet, defaults}, CompositeNewestUpdated()).Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, newer, updated)
+}
+
+func TestCompositeBackendPartialFailure(t *testing.T) {
+	t.Parallel()
+
+	overrides := &staticBackend{err: errors.New("no such file")}
+	fleet := &staticBackend{flags: []*flags2.Flag2{offFlag("a"), offFlag("b")}}
+	defaults := &staticBackend{flags: []*flags2.Flag2{onFlag("c")}}
+
+	var failed []int
+	backend := NewCompositeBackend([]Backend{overrides, fleet, defaults},
+		CompositeOptional(0),
+		CompositeErrorCallback(func(index int, err error) {
+			failed = append(failed, index)
+		}))
+
+	// A missing optional source is skipped.
+	flags, _, err := backend.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, []*flags2.Flag2{offFlag("a"), offFlag("b"), onFlag("c")}, flags)
+	assert.Equal(t, []int{0}, failed)
+
+	// A failing source keeps its last good flags.
+	fleet.flags = nil
+	fleet.err = errors.New("read failed")
+	flags, _, err = backend.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, []*flags2.Flag2{offFlag("a"), offFlag("b"), onFlag("c")}, flags)
+	assert.Equal(t, []int{0, 0, 1}, failed)
+
+	// Only fail if every source fails.
+	defaults.err = errors.New("read failed")
+	_, _, err = backend.Refresh()
+	assert.Error(t, err)
+}
+
+func TestCompositeBackendColdStart(t *testing.T) {
+	t.Parallel()
+
+	fleet := &staticBackend{err: errors.New("no such file")}
+	defaults := &staticBackend{flags: []*flags2.Flag2{onFlag("c")}}
+
+	var failed []int
+	backend := NewCompositeBackend([]Backend{fleet, defaults},
+		CompositeErrorCallback(func(index int, err error) {
+			failed = append(failed, index)
+		}))
+
+	// Defaults alone aren't enough until the fleet-wide source loads.
+	_, _, err := backend.Refresh()
+	assert.ErrorContains(t, err, "backend 0: no such file")
+	assert.Empty(t, failed)
+
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	assert.False(t, g.Ready())
+
+	fleet.err = nil
+	fleet.flags = []*flags2.Flag2{offFlag("a")}
+	flags, _, err := backend.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, []*flags2.Flag2{offFlag("a"), onFlag("c")}, flags)
+
+	// Once it has loaded, it can fail and keep its last good flags.
+	fleet.err = errors.New("read failed")
+	flags, _, err = backend.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, []*flags2.Flag2{offFlag("a"), onFlag("c")}, flags)
+	assert.Equal(t, []int{0}, failed)
+}
+
+func TestCompositeBackendOptionalFileRemoved(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	overridesPath := filepath.Join(dir, "overrides.json")
+	fleetPath := filepath.Join(dir, "fleet.json")
+	require.NoError(t, os.WriteFile(overridesPath, []byte(`{"flags": [
+		{"name": "go.a", "rules": [{"hash_by": "_random", "percent": 1.0, "predicates": []}]}
+	]}`), 0o644))
+	require.NoError(t, os.WriteFile(fleetPath, []byte(`{"flags": [
+		{"name": "go.a", "rules": []},
+		{"name": "go.b", "rules": []}
+	]}`), 0o644))
+
+	backend := NewCompositeBackend([]Backend{
+		BackendFromJSONFile2(overridesPath),
+		BackendFromJSONFile2(fleetPath),
+	}, CompositeOptional(0))
+	flags, _, err := backend.Refresh()
+	require.NoError(t, err)
+	require.Len(t, flags, 2)
+	assert.Equal(t, "go.a", flags[0].Name)
+	assert.Len(t, flags[0].Rules, 1)
+
+	// Deleting the override file removes its overrides.
+	require.NoError(t, os.Remove(overridesPath))
+	flags, _, err = backend.Refresh()
+	require.NoError(t, err)
+	require.Len(t, flags, 2)
+	assert.Equal(t, "go.a", flags[0].Name)
+	assert.Empty(t, flags[0].Rules)
+}
+
+func TestCachingBackend(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "flags.json")
+	updated := time.Unix(1584642857, 0)
+	source := &staticBackend{flags: []*flags2.Flag2{onFlag("a"), offFlag("b")}, updated: updated}
+
+	// Without a cache file, errors are passed through.
+	var cacheErrs []error
+	backend := NewCachingBackend(&staticBackend{err: errors.New("read failed")}, path,
+		CacheErrorCallback(func(err error) { cacheErrs = append(cacheErrs, err) }))
+	_, _, err := backend.Refresh()
+	assert.Error(t, err)
+
+	// Successful refreshes are written to the cache file.
+	flags, _, err := NewCachingBackend(source, path).Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, source.flags, flags)
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+
+	// Now a failing source is answered from the cache.
+	flags, cachedUpdated, err := backend.Refresh()
+	require.NoError(t, err)
+	assert.Equal(t, source.flags, flags)
+	assert.Equal(t, updated.Unix(), cachedUpdated.Unix())
+	require.Len(t, cacheErrs, 1)
+	assert.Contains(t, cacheErrs[0].Error(), "read failed")
+
+	// But not once the source has succeeded.
+	source.err = nil
+	backend = NewCachingBackend(source, path)
+	_, _, err = backend.Refresh()
+	require.NoError(t, err)
+	source.err = errors.New("read failed")
+	_, _, err = backend.Refresh()
+	assert.Error(t, err)
+}
+
+func TestCachingBackendColdStart(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "flags.json")
+	_, _, err := NewCachingBackend(&staticBackend{flags: []*flags2.Flag2{onFlag("a")}}, path).Refresh()
+	require.NoError(t, err)
+
+	backend := NewCachingBackend(&staticBackend{err: errors.New("read failed")}, path)
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	assert.True(t, g.Enabled(context.Background(), "a", nil))
+}
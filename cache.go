@@ -0,0 +1,108 @@
+package goforit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/stripe/goforit/flags2"
+)
+
+// CacheOption configures a backend created by NewCachingBackend.
+type CacheOption func(b *cachingBackend)
+
+// CacheErrorCallback registers a callback to execute when the cache file
+// can't be written, or when a source error is hidden by serving flags from
+// the cache file.
+func CacheErrorCallback(cb func(err error)) CacheOption {
+	return func(b *cachingBackend) {
+		b.errorCB = cb
+	}
+}
+
+type cachingBackend struct {
+	backend Backend
+	path    string
+	errorCB func(err error)
+
+	// succeeded is set once backend has refreshed successfully
+	succeeded atomic.Bool
+}
+
+// NewCachingBackend wraps a backend so that each successful refresh is
+// written to a local cache file, as a JSON v2 document.
+//
+// Until the wrapped backend first succeeds, refresh errors are answered with
+// the flags in the cache file instead, so a process that starts while its
+// flag source is unavailable still gets the last known good flags. The
+// cached flags carry their original updated time, so the age of the cache is
+// reported by the usual staleness checks.
+func NewCachingBackend(backend Backend, path string, opts ...CacheOption) Backend {
+	b := &cachingBackend{
+		backend: backend,
+		path:    path,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *cachingBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
+	flags, updated, err := b.backend.Refresh()
+	if err == nil {
+		b.succeeded.Store(true)
+		if werr := b.write(flags, updated); werr != nil && b.errorCB != nil {
+			b.errorCB(fmt.Errorf("writing flag cache %s: %w", b.path, werr))
+		}
+		return flags, updated, nil
+	}
+
+	if b.succeeded.Load() {
+		// We already have something better than the cache file in memory.
+		return nil, time.Time{}, err
+	}
+
+	cached, cachedUpdated, cerr := jsonFileBackend2{filename: b.path}.Refresh()
+	if cerr != nil {
+		return nil, time.Time{}, fmt.Errorf("%w (reading flag cache %s: %s)", err, b.path, cerr)
+	}
+	if b.errorCB != nil {
+		b.errorCB(fmt.Errorf("serving flags from cache %s: %w", b.path, err))
+	}
+	return cached, cachedUpdated, nil
+}
+
+// write atomically replaces the cache file with the given flags.
+func (b *cachingBackend) write(flags []*flags2.Flag2, updated time.Time) error {
+	doc := flags2.JSONFormat2{Flags: flags}
+	if !updated.IsZero() {
+		doc.Updated = float64(updated.UnixNano()) / float64(time.Second)
+	}
+	buf, err := json.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(b.path), filepath.Base(b.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	if _, err := f.Write(buf); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), b.path)
+}
@@ -8,3 +8,16 @@ const (
 	AlwaysOn
 	MayVary
 )
+
+func (c Clamp) String() string {
+	switch c {
+	case AlwaysOff:
+		return "always_off"
+	case AlwaysOn:
+		return "always_on"
+	case MayVary:
+		return "may_vary"
+	default:
+		return "unknown"
+	}
+}
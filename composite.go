@@ -0,0 +1,158 @@
+package goforit
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/goforit/flags2"
+)
+
+// CompositeOption configures a backend created by NewCompositeBackend.
+type CompositeOption func(b *compositeBackend)
+
+// CompositeNewestUpdated makes the composite backend report the newest
+// updated time of its sources. By default, it reports the oldest, so that
+// staleness checks notice when any source stops updating.
+func CompositeNewestUpdated() CompositeOption {
+	return func(b *compositeBackend) {
+		b.newest = true
+	}
+}
+
+// CompositeErrorCallback registers a callback to execute when one of the
+// sources fails to refresh, but the composite backend as a whole succeeds.
+// The index identifies the failing source.
+func CompositeErrorCallback(cb func(index int, err error)) CompositeOption {
+	return func(b *compositeBackend) {
+		b.errorCB = cb
+	}
+}
+
+// CompositeOptional marks the sources with the given indexes as optional, such
+// as a local override file that usually doesn't exist. Refresh fails until
+// every other source has refreshed successfully at least once. If an optional
+// source fails because its file doesn't exist, it contributes no flags, so
+// that deleting an override file removes its overrides.
+func CompositeOptional(indexes ...int) CompositeOption {
+	return func(b *compositeBackend) {
+		for _, i := range indexes {
+			b.optional[i] = true
+		}
+	}
+}
+
+type compositeLayer struct {
+	flags   []*flags2.Flag2
+	updated time.Time
+	loaded  bool
+}
+
+type compositeBackend struct {
+	backends []Backend
+	newest   bool
+	optional map[int]bool
+	errorCB  func(index int, err error)
+
+	mu sync.Mutex
+	// layers holds the last successful result of each backend
+	layers []compositeLayer
+}
+
+// NewCompositeBackend creates a backend that merges the flags of several
+// backends. For each flag name, the definition from the earliest backend
+// that defines it wins, so backends should be ordered from highest to
+// lowest precedence; for example, a local override file, then the
+// fleet-wide flag file, then a file of baked-in defaults.
+//
+// Refresh fails until every source that isn't marked with CompositeOptional
+// has refreshed successfully, so that a process doesn't start with only its
+// defaults. After that, a source that fails to refresh contributes the flags
+// from its last successful refresh, if any, unless it is optional and its file
+// doesn't exist. Refresh only fails if every source fails.
+func NewCompositeBackend(backends []Backend, opts ...CompositeOption) Backend {
+	b := &compositeBackend{
+		backends: backends,
+		optional: make(map[int]bool),
+		layers:   make([]compositeLayer, len(backends)),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *compositeBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	errs := make([]error, len(b.backends))
+	var msgs, missing []string
+	for i, backend := range b.backends {
+		flags, updated, err := backend.Refresh()
+		if err != nil {
+			errs[i] = err
+			msgs = append(msgs, fmt.Sprintf("backend %d: %s", i, err))
+			if !b.layers[i].loaded && !b.optional[i] {
+				missing = append(missing, fmt.Sprintf("backend %d: %s", i, err))
+			}
+			if b.optional[i] && errors.Is(err, fs.ErrNotExist) {
+				b.layers[i] = compositeLayer{}
+			}
+			continue
+		}
+		b.layers[i] = compositeLayer{flags: flags, updated: updated, loaded: true}
+	}
+	if len(msgs) == len(b.backends) {
+		return nil, time.Time{}, fmt.Errorf("all backends failed: %s", strings.Join(msgs, "; "))
+	}
+	if len(missing) > 0 {
+		return nil, time.Time{}, fmt.Errorf("required backends have never loaded: %s", strings.Join(missing, "; "))
+	}
+	if b.errorCB != nil {
+		for i, err := range errs {
+			if err != nil {
+				b.errorCB(i, err)
+			}
+		}
+	}
+
+	// The first layer to define a name owns it. All of that layer's
+	// definitions are kept, so duplicates within a layer behave the same
+	// as they would without the composite.
+	owners := make(map[string]int)
+	for i := range b.layers {
+		for _, flag := range b.layers[i].flags {
+			if _, ok := owners[flag.FlagName()]; !ok {
+				owners[flag.FlagName()] = i
+			}
+		}
+	}
+
+	var merged []*flags2.Flag2
+	var updated time.Time
+	for i, layer := range b.layers {
+		if !layer.loaded {
+			continue
+		}
+		for _, flag := range layer.flags {
+			if owners[flag.FlagName()] == i {
+				merged = append(merged, flag)
+			}
+		}
+
+		if layer.updated.IsZero() {
+			continue
+		}
+		if updated.IsZero() ||
+			(b.newest && layer.updated.After(updated)) ||
+			(!b.newest && layer.updated.Before(updated)) {
+			updated = layer.updated
+		}
+	}
+
+	return merged, updated, nil
+}
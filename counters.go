@@ -0,0 +1,202 @@
+package goforit
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FlagCounts describes how the evaluations of a flag since the last report
+// were decided.
+type FlagCounts struct {
+	Name      string
+	IsDeleted bool
+	// Total and Enabled count the evaluations decided by the flag itself,
+	// like ReportCounts.
+	Total   uint64
+	Enabled uint64
+	// Overrides counts the evaluations decided by a context or runtime
+	// override.
+	Overrides uint64
+	// Errors counts the evaluations that failed, for example because a
+	// predicate couldn't be evaluated.
+	Errors uint64
+	// NoRuleMatch counts the evaluations where no rule decided the result.
+	NoRuleMatch uint64
+	// Rules counts the evaluations decided by each rule, by index.
+	Rules []uint64
+}
+
+// cachelineSize is the size of a cacheline on the CPUs we care about.
+const cachelineSize = 64
+
+const (
+	counterOverride = iota
+	counterError
+	counterNoRuleMatch
+	counterRules
+)
+
+// counterShards is the number of copies of each flag's detailed counters, a
+// power of two.
+var counterShards = func() int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0) && n < 8 {
+		n *= 2
+	}
+	return n
+}()
+
+// shardHints hands out a shard to use. Since sync.Pool keeps a cache per P,
+// concurrent evaluations usually get different shards.
+var (
+	nextShardHint atomic.Uint32
+	shardHints    = sync.Pool{
+		New: func() interface{} {
+			hint := int(nextShardHint.Add(1))
+			return &hint
+		},
+	}
+)
+
+func shardHint() int {
+	hint := shardHints.Get().(*int)
+	shard := *hint
+	shardHints.Put(hint)
+	return shard
+}
+
+// flagCounters counts how evaluations of a flag were decided, sharded so that
+// concurrent evaluations don't contend on the same cacheline.
+type flagCounters struct {
+	// stride is the number of counters in each shard, rounded up to a whole
+	// cacheline.
+	stride int
+	counts []atomic.Uint64
+}
+
+func newFlagCounters(rules int) *flagCounters {
+	const perLine = cachelineSize / 8
+	stride := (counterRules + rules + perLine - 1) / perLine * perLine
+	return &flagCounters{
+		stride: stride,
+		counts: make([]atomic.Uint64, stride*counterShards),
+	}
+}
+
+func (c *flagCounters) add(counter int) {
+	shard := shardHint() & (counterShards - 1)
+	c.counts[shard*c.stride+counter].Add(1)
+}
+
+// take returns the sum of counter over every shard, and resets it.
+func (c *flagCounters) take(counter int) uint64 {
+	var sum uint64
+	for shard := 0; shard < counterShards; shard++ {
+		sum += c.counts[shard*c.stride+counter].Swap(0)
+	}
+	return sum
+}
+
+// DetailedCounts counts how each evaluation was decided, for
+// ReportDetailedCounts. It is off by default, since it makes evaluating flags
+// that may vary slightly more expensive.
+func DetailedCounts(enabled bool) Option {
+	return optionFunc(func(g *goforit) {
+		g.detailedCounts = enabled
+	})
+}
+
+// count increments one of the detailed counters of a flag, if they are
+// enabled.
+func (g *goforit) count(fh *flagHolder, counter int) {
+	if g.detailedCounts {
+		g.countDetailed(fh, counter)
+	}
+}
+
+//go:noinline
+func (g *goforit) countDetailed(fh *flagHolder, counter int) {
+	c, ok := g.counters.Load(fh)
+	if !ok {
+		// Allocate on first use, since most flags are never evaluated.
+		c, _ = g.counters.LoadOrStore(fh, newFlagCounters(len(fh.flag.Rules)))
+	}
+	c.(*flagCounters).add(counter)
+}
+
+// loadCounters returns the detailed counters of a flag, or nil if it hasn't
+// been counted in detail.
+func (g *goforit) loadCounters(fh *flagHolder) *flagCounters {
+	if c, ok := g.counters.Load(fh); ok {
+		return c.(*flagCounters)
+	}
+	return nil
+}
+
+// CountReporter is implemented by the Goforit returned by New, to report
+// counts in more detail than ReportCounts.
+type CountReporter interface {
+	ReportDetailedCounts(callback func(counts FlagCounts))
+	ReportUnknownCounts(callback func(name string, count uint64))
+}
+
+// ReportDetailedCounts is like ReportCounts, but also reports how the
+// evaluations were decided if the DetailedCounts option is used. It resets
+// the same counts as ReportCounts, so only one of them should be used.
+func (g *goforit) ReportDetailedCounts(callback func(counts FlagCounts)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	start := time.Now()
+	scanned := int64(0)
+	reported := int64(0)
+
+	flags := g.flags.load()
+	// Drop the counters of flags that have since been redefined or removed.
+	g.counters.Range(func(key, _ interface{}) bool {
+		fh := key.(*flagHolder)
+		if flags[fh.flag.FlagName()] != fh {
+			g.counters.Delete(key)
+		}
+		return true
+	})
+
+	for name, fh := range flags {
+		scanned++
+		c := g.loadCounters(fh)
+		if c == nil && fh.disabledCount.Load() == 0 && fh.enabledCount.Load() == 0 {
+			continue
+		}
+
+		disabled := fh.disabledCount.Swap(0)
+		enabled := fh.enabledCount.Swap(0)
+		counts := FlagCounts{
+			Name:      name,
+			IsDeleted: fh.flag.IsDeleted(),
+			Total:     disabled + enabled,
+			Enabled:   enabled,
+		}
+		if c != nil {
+			counts.Overrides = c.take(counterOverride)
+			counts.Errors = c.take(counterError)
+			counts.NoRuleMatch = c.take(counterNoRuleMatch)
+			counts.Rules = make([]uint64, len(fh.flag.Rules))
+			for i := range counts.Rules {
+				counts.Rules[i] = c.take(counterRules + i)
+			}
+		}
+		if counts.Total == 0 && counts.Overrides == 0 {
+			continue
+		}
+		callback(counts)
+		reported++
+	}
+
+	duration := time.Now().Sub(start)
+	stats := g.getStats()
+	_ = stats.Gauge(reportCountsScannedMetricName, float64(scanned), nil, 1.0)
+	_ = stats.Gauge(reportCountsReportedMetricName, float64(reported), nil, 1.0)
+	_ = stats.TimeInMilliseconds(reportCountsDurationMetricName, duration.Seconds()*1000, nil, 1.0)
+}
@@ -0,0 +1,372 @@
+// Package debug serves the live state of a goforit instance over HTTP, to
+// find out which flags a running process actually has loaded.
+//
+// The handler is meant to be mounted on an internal debug mux:
+//
+//	mux.Handle("/debug/goforit/", http.StripPrefix("/debug/goforit", debug.NewHandler(g)))
+//
+// It serves these endpoints, all of which respond with JSON:
+//
+//	GET /                Status, default tags, runtime overrides and every loaded flag.
+//	GET /flags/<name>    A single flag.
+//	GET /evaluate/<name> Evaluates a flag with the query string as properties, without counting it.
+//	GET /overrides       The runtime overrides.
+//
+// With the WithOverrides option, runtime overrides can also be changed:
+//
+//	PUT /overrides/<name>?enabled=false&ttl=1h Sets an override, expiring after the optional ttl.
+//	DELETE /overrides/<name>                   Clears an override.
+package debug
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/flags2"
+)
+
+// Status is the JSON form of goforit.Status.
+type Status struct {
+	Ready               bool      `json:"ready"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastError           string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Failures            uint64    `json:"failures"`
+	FlagCount           int       `json:"flag_count"`
+	Version             uint64    `json:"version"`
+}
+
+// Flag describes a loaded flag.
+type Flag struct {
+	Name       string        `json:"name"`
+	Definition *flags2.Flag2 `json:"definition"`
+	// Clamp is "always_on" or "always_off" if the flag has the same value
+	// for everyone, or "may_vary" otherwise.
+	Clamp   string `json:"clamp"`
+	Expired bool   `json:"expired"`
+	// Evaluations and Enabled count evaluations since counts were last
+	// reported.
+	Evaluations uint64 `json:"evaluations"`
+	Enabled     uint64 `json:"enabled"`
+}
+
+// Override is the JSON form of goforit.RuntimeOverride.
+type Override struct {
+	Flag    string `json:"flag"`
+	Enabled bool   `json:"enabled"`
+	// Expires is omitted if the override doesn't expire.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// State is the response from the / endpoint.
+type State struct {
+	Status      Status            `json:"status"`
+	DefaultTags map[string]string `json:"default_tags"`
+	Overrides   []Override        `json:"overrides"`
+	Flags       []Flag            `json:"flags"`
+}
+
+// AuditFunc is called before a runtime override is set or cleared through
+// the handler. If it returns an error, the change is refused with a 403.
+type AuditFunc func(r *http.Request, override goforit.RuntimeOverride, cleared bool) error
+
+// Option configures a handler created by NewHandler.
+type Option func(h *handler)
+
+// WithOverrides lets requests set and clear runtime overrides. Every change
+// is passed to audit first, which should log it, and can refuse it. Only
+// enable this on a mux that is not exposed to untrusted clients.
+func WithOverrides(audit AuditFunc) Option {
+	return func(h *handler) {
+		h.overridesEnabled = true
+		h.audit = audit
+	}
+}
+
+// Explanation is the response from the /evaluate endpoint.
+type Explanation struct {
+	Evaluation goforit.Evaluation `json:"evaluation"`
+	// Properties are the properties the flag was evaluated with, including
+	// default tags.
+	Properties map[string]string `json:"properties"`
+	// Definition is the flag's definition, if it is loaded.
+	Definition *flags2.Flag2 `json:"definition,omitempty"`
+	// Rule is the rule that decided the flag's value, if any.
+	Rule *flags2.Rule2 `json:"rule,omitempty"`
+	// Explanation describes the evaluation in words.
+	Explanation string `json:"explanation"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Goforit is the part of goforit's API the handler uses. The Goforit returned
+// by goforit.New implements it.
+type Goforit interface {
+	goforit.Evaluator
+	goforit.StatusReporter
+	goforit.Inspector
+	goforit.Overrider
+}
+
+type handler struct {
+	g   Goforit
+	mux *http.ServeMux
+
+	overridesEnabled bool
+	audit            AuditFunc
+}
+
+// NewHandler returns an http.Handler that serves the state of g.
+func NewHandler(g Goforit, opts ...Option) http.Handler {
+	h := &handler{g: g, mux: http.NewServeMux()}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.mux.HandleFunc("/", h.state)
+	h.mux.HandleFunc("/flags/", h.flag)
+	h.mux.HandleFunc("/evaluate/", h.evaluate)
+	h.mux.HandleFunc("/overrides", h.overrides)
+	h.mux.HandleFunc("/overrides/", h.override)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// allowMethod writes an error response and returns false if the request's
+// method isn't one of methods.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	return false
+}
+
+func (h *handler) state(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	if r.URL.Path != "/" {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+
+	states := h.g.FlagStates()
+	state := State{
+		Status:      newStatus(h.g.Status()),
+		DefaultTags: h.g.DefaultTags(),
+		Overrides:   newOverrides(h.g.RuntimeOverrides()),
+		Flags:       make([]Flag, len(states)),
+	}
+	for i, s := range states {
+		state.Flags[i] = newFlag(s)
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (h *handler) flag(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/flags/")
+	for _, s := range h.g.FlagStates() {
+		if s.Flag.Name == name {
+			writeJSON(w, http.StatusOK, newFlag(s))
+			return
+		}
+	}
+	writeJSON(w, http.StatusNotFound, errorResponse{Error: fmt.Sprintf("flag %s is not loaded", name)})
+}
+
+func (h *handler) evaluate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/evaluate/")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "no flag given"})
+		return
+	}
+
+	query := r.URL.Query()
+	props := make(map[string]string, len(query))
+	for key := range query {
+		props[key] = query.Get(key)
+	}
+
+	e := h.g.Explain(r.Context(), name, props)
+	explanation := Explanation{
+		Evaluation: e,
+		Properties: h.g.DefaultTags(),
+	}
+	for k, v := range props {
+		explanation.Properties[k] = v
+	}
+	if flag, ok := h.g.Flag(name); ok {
+		explanation.Definition = flag
+		if e.Rule >= 0 && e.Rule < len(flag.Rules) {
+			explanation.Rule = &flag.Rules[e.Rule]
+		}
+	}
+	explanation.Explanation = explain(e, explanation.Rule)
+	writeJSON(w, http.StatusOK, explanation)
+}
+
+func (h *handler) overrides(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	writeJSON(w, http.StatusOK, newOverrides(h.g.RuntimeOverrides()))
+}
+
+func (h *handler) override(w http.ResponseWriter, r *http.Request) {
+	if !h.overridesEnabled {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "runtime overrides are not enabled"})
+		return
+	}
+	if !allowMethod(w, r, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/overrides/")
+	if name == "" {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "no flag given"})
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if !h.allowChange(w, r, goforit.RuntimeOverride{Flag: name}, true) {
+			return
+		}
+		h.g.ClearOverride(name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	query := r.URL.Query()
+	enabled, err := strconv.ParseBool(query.Get("enabled"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid enabled: %s", err)})
+		return
+	}
+	var ttl time.Duration
+	if s := query.Get("ttl"); s != "" {
+		if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid ttl %q", s)})
+			return
+		}
+	}
+
+	o := goforit.RuntimeOverride{Flag: name, Enabled: enabled}
+	if ttl > 0 {
+		o.Expires = time.Now().Add(ttl)
+	}
+	if !h.allowChange(w, r, o, false) {
+		return
+	}
+	h.g.SetOverride(name, enabled, ttl)
+	writeJSON(w, http.StatusOK, newOverride(o))
+}
+
+// allowChange passes a change to the audit function, and writes an error
+// response and returns false if it is refused.
+func (h *handler) allowChange(w http.ResponseWriter, r *http.Request, o goforit.RuntimeOverride, cleared bool) bool {
+	if h.audit == nil {
+		return true
+	}
+	if err := h.audit(r, o, cleared); err != nil {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: err.Error()})
+		return false
+	}
+	return true
+}
+
+func explain(e goforit.Evaluation, rule *flags2.Rule2) string {
+	value := "off"
+	if e.Enabled {
+		value = "on"
+	}
+	switch e.Reason {
+	case goforit.ReasonUndefined:
+		return fmt.Sprintf("%s is not loaded, so it is %s", e.Flag, value)
+	case goforit.ReasonOverride:
+		return fmt.Sprintf("%s is overridden %s in the request context", e.Flag, value)
+	case goforit.ReasonRuntimeOverride:
+		return fmt.Sprintf("%s is overridden %s in this process", e.Flag, value)
+	case goforit.ReasonStatic:
+		return fmt.Sprintf("%s is always %s", e.Flag, value)
+	case goforit.ReasonNoRuleMatch:
+		return fmt.Sprintf("no rule of %s matched, so it is off", e.Flag)
+	case goforit.ReasonError:
+		return fmt.Sprintf("rule %d of %s failed, so it is off: %s", e.Rule, e.Flag, e.Error)
+	case goforit.ReasonRuleMatch:
+		if rule != nil && rule.Percent > flags2.PercentOff && rule.Percent < flags2.PercentOn {
+			return fmt.Sprintf("rule %d of %s matched, and turns it on for %v%% by %s, so it is %s",
+				e.Rule, e.Flag, rule.Percent*100, rule.HashBy, value)
+		}
+		return fmt.Sprintf("rule %d of %s matched, so it is %s", e.Rule, e.Flag, value)
+	default:
+		return fmt.Sprintf("%s is %s", e.Flag, value)
+	}
+}
+
+func newStatus(s goforit.Status) Status {
+	status := Status{
+		Ready:               s.Ready,
+		LastSuccess:         s.LastSuccess,
+		ConsecutiveFailures: s.ConsecutiveFailures,
+		Failures:            s.Failures,
+		FlagCount:           s.FlagCount,
+		Version:             s.Version,
+	}
+	if s.LastError != nil {
+		status.LastError = s.LastError.Error()
+	}
+	return status
+}
+
+func newOverride(o goforit.RuntimeOverride) Override {
+	override := Override{Flag: o.Flag, Enabled: o.Enabled}
+	if !o.Expires.IsZero() {
+		override.Expires = &o.Expires
+	}
+	return override
+}
+
+func newOverrides(list []goforit.RuntimeOverride) []Override {
+	overrides := make([]Override, len(list))
+	for i, o := range list {
+		overrides[i] = newOverride(o)
+	}
+	return overrides
+}
+
+func newFlag(s goforit.FlagState) Flag {
+	return Flag{
+		Name:        s.Flag.Name,
+		Definition:  s.Flag,
+		Clamp:       s.Clamp.String(),
+		Expired:     s.Expired,
+		Evaluations: s.Total,
+		Enabled:     s.Enabled,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,153 @@
+package debug
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/goforittest"
+)
+
+type testGoforit interface {
+	goforit.Goforit
+	Goforit
+}
+
+func testHandler(t *testing.T) (testGoforit, http.Handler) {
+	g := goforittest.New(t, goforittest.Load(t, filepath.Join("..", "testdata", "flags2_example.json")))
+	g.AddDefaultTags(map[string]string{"country": "US"})
+	return g, NewHandler(g)
+}
+
+func get(t *testing.T, h http.Handler, path string, v interface{}) int {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+	return rec.Code
+}
+
+func TestState(t *testing.T) {
+	t.Parallel()
+
+	g, h := testHandler(t)
+	assert.True(t, g.Enabled(context.Background(), "go.moon.mercury", nil))
+
+	var state State
+	assert.Equal(t, http.StatusOK, get(t, h, "/", &state))
+	assert.True(t, state.Status.Ready)
+	assert.False(t, state.Status.LastSuccess.IsZero())
+	assert.Equal(t, 5, state.Status.FlagCount)
+	assert.Equal(t, map[string]string{"country": "US"}, state.DefaultTags)
+	require.Len(t, state.Flags, 5)
+	assert.Equal(t, "flag5", state.Flags[0].Name)
+	assert.Equal(t, "may_vary", state.Flags[0].Clamp)
+
+	var flag Flag
+	assert.Equal(t, http.StatusOK, get(t, h, "/flags/go.moon.mercury", &flag))
+	assert.Equal(t, "go.moon.mercury", flag.Name)
+	assert.Equal(t, "always_on", flag.Clamp)
+	assert.Equal(t, uint64(1), flag.Evaluations)
+	assert.Equal(t, uint64(1), flag.Enabled)
+	assert.Len(t, flag.Definition.Rules, 1)
+
+	// Reading counters doesn't reset them.
+	assert.Equal(t, http.StatusOK, get(t, h, "/flags/go.moon.mercury", &flag))
+	assert.Equal(t, uint64(1), flag.Evaluations)
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/flags/missing", &flag))
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/nope", &state))
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	_, h := testHandler(t)
+
+	var e Explanation
+	assert.Equal(t, http.StatusOK, get(t, h, "/evaluate/flag5?token=id_1", &e))
+	assert.Equal(t, goforit.Evaluation{Flag: "flag5", Enabled: true, Reason: goforit.ReasonRuleMatch, Rule: 0}, e.Evaluation)
+	assert.Equal(t, map[string]string{"token": "id_1", "country": "US"}, e.Properties)
+	require.NotNil(t, e.Rule)
+	assert.Equal(t, "token", e.Rule.HashBy)
+	assert.Equal(t, "rule 0 of flag5 matched, so it is on", e.Explanation)
+
+	e = Explanation{}
+	assert.Equal(t, http.StatusOK, get(t, h, "/evaluate/missing", &e))
+	assert.Equal(t, goforit.ReasonUndefined, e.Evaluation.Reason)
+	assert.Nil(t, e.Definition)
+	assert.Equal(t, "missing is not loaded, so it is off", e.Explanation)
+
+	// Explaining flags doesn't count as evaluating them.
+	var flag Flag
+	assert.Equal(t, http.StatusOK, get(t, h, "/flags/flag5", &flag))
+	assert.Equal(t, uint64(0), flag.Evaluations)
+
+	req := httptest.NewRequest(http.MethodPost, "/evaluate/flag5", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func do(h http.Handler, method, path string) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec.Code
+}
+
+func TestOverrides(t *testing.T) {
+	t.Parallel()
+
+	g, h := testHandler(t)
+	assert.Equal(t, http.StatusNotFound, do(h, http.MethodPut, "/overrides/flag5?enabled=false"))
+
+	var audited []goforit.RuntimeOverride
+	h = NewHandler(g, WithOverrides(func(r *http.Request, override goforit.RuntimeOverride, cleared bool) error {
+		if r.Header.Get("X-User") == "" {
+			return errors.New("who are you?")
+		}
+		audited = append(audited, override)
+		return nil
+	}))
+
+	assert.Equal(t, http.StatusForbidden, do(h, http.MethodPut, "/overrides/flag5?enabled=false"))
+	assert.Empty(t, g.RuntimeOverrides())
+
+	req := httptest.NewRequest(http.MethodPut, "/overrides/flag5?enabled=false&ttl=1h", nil)
+	req.Header.Set("X-User", "alice")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, g.Enabled(context.Background(), "flag5", map[string]string{"token": "id_1"}))
+
+	var overrides []Override
+	assert.Equal(t, http.StatusOK, get(t, h, "/overrides", &overrides))
+	require.Len(t, overrides, 1)
+	assert.Equal(t, "flag5", overrides[0].Flag)
+	assert.NotNil(t, overrides[0].Expires)
+
+	var e Explanation
+	assert.Equal(t, http.StatusOK, get(t, h, "/evaluate/flag5?token=id_1", &e))
+	assert.Equal(t, "flag5 is overridden off in this process", e.Explanation)
+
+	req = httptest.NewRequest(http.MethodDelete, "/overrides/flag5", nil)
+	req.Header.Set("X-User", "alice")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, g.RuntimeOverrides())
+	assert.Len(t, audited, 2)
+
+	assert.Equal(t, http.StatusBadRequest, do(h, http.MethodPut, "/overrides/flag5?enabled=maybe"))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(h, http.MethodPost, "/overrides/flag5"))
+}
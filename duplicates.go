@@ -0,0 +1,108 @@
+package goforit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stripe/goforit/flags2"
+)
+
+const duplicatesMetricName = "goforit.flags.duplicates"
+
+// DuplicatePolicy decides which definition to use when a backend returns
+// several flags with the same name.
+type DuplicatePolicy int
+
+const (
+	// DuplicateLastWins uses the last definition. This is the default.
+	DuplicateLastWins DuplicatePolicy = iota
+	// DuplicateFirstWins uses the first definition.
+	DuplicateFirstWins
+	// DuplicateReject fails the refresh, keeping the previous flags.
+	DuplicateReject
+)
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateLastWins:
+		return "keeping the last"
+	case DuplicateFirstWins:
+		return "keeping the first"
+	case DuplicateReject:
+		return "rejecting them"
+	default:
+		return fmt.Sprintf("DuplicatePolicy(%d)", int(p))
+	}
+}
+
+// WithDuplicatePolicy sets how flags with the same name are handled. Each
+// refresh with duplicates is counted in the goforit.flags.duplicates metric,
+// and logged whenever the duplicates differ from the previous refresh.
+func WithDuplicatePolicy(policy DuplicatePolicy) Option {
+	return optionFunc(func(g *goforit) {
+		g.duplicatePolicy = policy
+	})
+}
+
+// resolveDuplicates applies the duplicate policy to flags.
+func (g *goforit) resolveDuplicates(flags []*flags2.Flag2) ([]*flags2.Flag2, error) {
+	indexes := make(map[string][]int, len(flags))
+	var duplicated []string
+	for i, flag := range flags {
+		name := flag.FlagName()
+		indexes[name] = append(indexes[name], i)
+		if len(indexes[name]) == 2 {
+			duplicated = append(duplicated, name)
+		}
+	}
+	if len(duplicated) == 0 {
+		g.lastDuplicates.Store(nil)
+		return flags, nil
+	}
+
+	descriptions := make([]string, len(duplicated))
+	for i, name := range duplicated {
+		descriptions[i] = fmt.Sprintf("%q at %s", name, describeDefinitions(flags, indexes[name]))
+	}
+	description := strings.Join(descriptions, ", ")
+
+	_ = g.getStats().Count(duplicatesMetricName, int64(len(duplicated)), nil, 1)
+	if last := g.lastDuplicates.Swap(&description); (last == nil || *last != description) && g.printf != nil {
+		g.printf("Flags are defined more than once, %s: %s", g.duplicatePolicy, description)
+	}
+
+	keep := make(map[int]bool, len(indexes))
+	for _, idxs := range indexes {
+		switch g.duplicatePolicy {
+		case DuplicateReject:
+			if len(idxs) > 1 {
+				return nil, fmt.Errorf("flags are defined more than once: %s", description)
+			}
+			keep[idxs[0]] = true
+		case DuplicateFirstWins:
+			keep[idxs[0]] = true
+		default:
+			keep[idxs[len(idxs)-1]] = true
+		}
+	}
+
+	resolved := make([]*flags2.Flag2, 0, len(keep))
+	for i, flag := range flags {
+		if keep[i] {
+			resolved = append(resolved, flag)
+		}
+	}
+	return resolved, nil
+}
+
+// describeDefinitions names the flags at the given indexes.
+func describeDefinitions(flags []*flags2.Flag2, idxs []int) string {
+	entries := make([]string, len(idxs))
+	for i, idx := range idxs {
+		entries[i] = fmt.Sprintf("index %d", idx)
+		if id := flags[idx].ID; id != "" {
+			entries[i] += fmt.Sprintf(" (_id %s)", id)
+		}
+	}
+	return strings.Join(entries, " and ")
+}
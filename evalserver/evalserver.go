@@ -0,0 +1,119 @@
+// Package evalserver exposes goforit flag evaluation over HTTP, so that
+// services not written in Go can share the exact same bucketing semantics.
+//
+// The handler serves two endpoints, both of which accept a JSON POST body:
+//
+//	POST /evaluate      {"flags": ["name", ...], "properties": {"key": "value"}}
+//	POST /evaluate_all  {"properties": {"key": "value"}, "prefix": "name.prefix."}
+//
+// Both respond with {"evaluations": {"name": {...}}}, where each value is a
+// goforit.Evaluation.
+package evalserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/stripe/goforit"
+)
+
+// maxBodyBytes bounds the size of request bodies we are willing to decode.
+const maxBodyBytes = 1 << 20
+
+// EvaluateRequest is the body of a request to the /evaluate endpoint.
+type EvaluateRequest struct {
+	Flags      []string          `json:"flags"`
+	Properties map[string]string `json:"properties"`
+}
+
+// EvaluateAllRequest is the body of a request to the /evaluate_all endpoint.
+// If Prefix is set, only flags whose names start with it are evaluated.
+type EvaluateAllRequest struct {
+	Properties map[string]string `json:"properties"`
+	Prefix     string            `json:"prefix"`
+}
+
+// Response is the body of a successful response from either endpoint.
+type Response struct {
+	Evaluations map[string]goforit.Evaluation `json:"evaluations"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type handler struct {
+	g   goforit.Evaluator
+	mux *http.ServeMux
+}
+
+// NewHandler returns an http.Handler that evaluates flags using g, which is
+// usually the Goforit returned by goforit.New. Default tags added to g apply
+// to every evaluation, and request properties take precedence over them, just
+// as they do for g.Enabled.
+func NewHandler(g goforit.Evaluator) http.Handler {
+	h := &handler{g: g, mux: http.NewServeMux()}
+	h.mux.HandleFunc("/evaluate", h.evaluate)
+	h.mux.HandleFunc("/evaluate_all", h.evaluateAll)
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *handler) evaluate(w http.ResponseWriter, r *http.Request) {
+	var req EvaluateRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if len(req.Flags) == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "no flags requested"})
+		return
+	}
+
+	resp := Response{Evaluations: make(map[string]goforit.Evaluation, len(req.Flags))}
+	for _, name := range req.Flags {
+		resp.Evaluations[name] = h.g.Evaluate(r.Context(), name, req.Properties)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) evaluateAll(w http.ResponseWriter, r *http.Request) {
+	var req EvaluateAllRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	var filter goforit.Filter
+	if req.Prefix != "" {
+		filter = goforit.PrefixFilter(req.Prefix)
+	}
+	resp := Response{Evaluations: h.g.EvaluateAll(r.Context(), req.Properties, filter)}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// decode reads a JSON request body into v. If it fails, it writes an error
+// response and returns false.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return false
+	}
+
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes))
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request body: %s", err)})
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,93 @@
+package evalserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/goforittest"
+)
+
+func testHandler(t *testing.T) http.Handler {
+	g := goforittest.New(t, goforittest.Load(t, filepath.Join("..", "testdata", "flags2_example.json")))
+	g.AddDefaultTags(map[string]string{"token": "id_2"})
+	return NewHandler(g)
+}
+
+func do(t *testing.T, h http.Handler, method, path, body string) (int, Response) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp Response
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	}
+	return rec.Code, resp
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	h := testHandler(t)
+
+	code, resp := do(t, h, http.MethodPost, "/evaluate",
+		`{"flags": ["flag5", "go.moon.mercury", "missing"], "properties": {"token": "id_1"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Evaluations, 3)
+	assert.Equal(t, goforit.Evaluation{Flag: "flag5", Enabled: true, Reason: goforit.ReasonRuleMatch, Rule: 0},
+		resp.Evaluations["flag5"])
+	assert.Equal(t, goforit.ReasonStatic, resp.Evaluations["go.moon.mercury"].Reason)
+	assert.Equal(t, goforit.ReasonUndefined, resp.Evaluations["missing"].Reason)
+
+	// Default tags apply when the request has no properties.
+	code, resp = do(t, h, http.MethodPost, "/evaluate", `{"flags": ["flag5"]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, resp.Evaluations["flag5"].Enabled)
+}
+
+func TestEvaluateAll(t *testing.T) {
+	t.Parallel()
+
+	h := testHandler(t)
+
+	code, resp := do(t, h, http.MethodPost, "/evaluate_all", `{"properties": {"token": "id_1"}}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Evaluations, 5)
+	assert.True(t, resp.Evaluations["flag5"].Enabled)
+	assert.False(t, resp.Evaluations["off_flag"].Enabled)
+
+	code, resp = do(t, h, http.MethodPost, "/evaluate_all", `{"prefix": "go.moon."}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"go.moon.mercury"}, keys(resp.Evaluations))
+}
+
+func keys(evaluations map[string]goforit.Evaluation) []string {
+	var names []string
+	for name := range evaluations {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestBadRequests(t *testing.T) {
+	t.Parallel()
+
+	h := testHandler(t)
+
+	code, _ := do(t, h, http.MethodGet, "/evaluate", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	code, _ = do(t, h, http.MethodPost, "/evaluate", "not json")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(t, h, http.MethodPost, "/evaluate", `{"properties": {}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = do(t, h, http.MethodPost, "/nope", `{}`)
+	assert.Equal(t, http.StatusNotFound, code)
+}
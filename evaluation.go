@@ -0,0 +1,213 @@
+package goforit
+
+import (
+	"context"
+	"strings"
+
+	"github.com/stripe/goforit/flags2"
+)
+
+// Reason describes why a flag evaluated to the value it did.
+type Reason string
+
+const (
+	// ReasonUndefined means no flag with the given name is loaded.
+	ReasonUndefined Reason = "undefined"
+	// ReasonOverride means the value came from a context override.
+	ReasonOverride Reason = "override"
+	// ReasonRuntimeOverride means the value came from an override set with
+	// SetOverride.
+	ReasonRuntimeOverride Reason = "runtime_override"
+	// ReasonStatic means the flag is always on or always off.
+	ReasonStatic Reason = "static"
+	// ReasonRuleMatch means one of the flag's rules decided the value.
+	ReasonRuleMatch Reason = "rule_match"
+	// ReasonNoRuleMatch means none of the flag's rules matched, so it is off.
+	ReasonNoRuleMatch Reason = "no_rule_match"
+	// ReasonError means a rule could not be evaluated, so the flag is off.
+	ReasonError Reason = "error"
+)
+
+// Evaluation is the result of evaluating a flag, along with an explanation.
+type Evaluation struct {
+	Flag    string `json:"flag"`
+	Enabled bool   `json:"enabled"`
+	Reason  Reason `json:"reason"`
+	// Rule is the index of the rule that decided the value, or -1 if no
+	// rule did.
+	Rule  int    `json:"rule"`
+	Error string `json:"error,omitempty"`
+}
+
+// EvaluationHook is called after each evaluation, with the context and
+// properties passed to Enabled or Evaluate. The properties are merged with
+// those attached to the context with WithProperties, like the flag was
+// evaluated with, and must not be modified. The context may be nil.
+type EvaluationHook func(ctx context.Context, properties map[string]string, evaluation Evaluation)
+
+// EvaluationHooks registers hooks to call after each evaluation, in order.
+// Unlike EvaluationCallback, hooks can be registered several times, so that
+// independent integrations can each add their own.
+func EvaluationHooks(hooks ...EvaluationHook) Option {
+	return optionFunc(func(g *goforit) {
+		g.evalHooks = append(g.evalHooks, hooks...)
+	})
+}
+
+func (g *goforit) runEvaluationHooks(ctx context.Context, properties map[string]string, evaluation Evaluation) {
+	for _, hook := range g.evalHooks {
+		hook(ctx, properties, evaluation)
+	}
+}
+
+// Evaluator is implemented by the Goforit returned by New, to explain
+// evaluations and evaluate several flags at once.
+type Evaluator interface {
+	EnabledWithFallback(ctx context.Context, name string, props map[string]string, fallback bool) (enabled bool)
+	Evaluate(ctx context.Context, name string, props map[string]string) Evaluation
+	EvaluateAll(ctx context.Context, props map[string]string, filter Filter) Evaluations
+	Snapshot() *Snapshot
+}
+
+// Evaluations maps flag names to their evaluations.
+type Evaluations map[string]Evaluation
+
+// Values returns just the value of each flag.
+func (es Evaluations) Values() map[string]bool {
+	values := make(map[string]bool, len(es))
+	for name, e := range es {
+		values[name] = e.Enabled
+	}
+	return values
+}
+
+// Filter selects the flags evaluated by EvaluateAll. The flag is nil if it
+// isn't loaded, but is overridden in the context or at runtime.
+type Filter func(name string, flag *flags2.Flag2) bool
+
+// PrefixFilter selects the flags whose names start with prefix.
+func PrefixFilter(prefix string) Filter {
+	return func(name string, flag *flags2.Flag2) bool {
+		return strings.HasPrefix(name, prefix)
+	}
+}
+
+// TagFilter selects the loaded flags tagged with tag.
+func TagFilter(tag string) Filter {
+	return func(name string, flag *flags2.Flag2) bool {
+		return flag != nil && flag.HasTag(tag)
+	}
+}
+
+func newEvaluation(name string, enabled bool, reason Reason, rule int, err error) Evaluation {
+	e := Evaluation{
+		Flag:    name,
+		Enabled: enabled,
+		Reason:  reason,
+		Rule:    rule,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// Evaluate is like Enabled, but also explains why the flag has its value.
+func (g *goforit) Evaluate(ctx context.Context, name string, properties map[string]string) Evaluation {
+	enabled, reason, rule, err := g.evaluate(nil, ctx, name, properties, false, false)
+	return newEvaluation(name, enabled, reason, rule, err)
+}
+
+// Explain is like Evaluate, but without side effects, for tools that inspect
+// flags: the evaluation isn't counted, and isn't passed to callbacks or
+// evaluation hooks.
+func (g *goforit) Explain(ctx context.Context, name string, properties map[string]string) Evaluation {
+	enabled, reason, rule, err := g.evaluate(nil, ctx, name, properties, false, true)
+	return newEvaluation(name, enabled, reason, rule, err)
+}
+
+// EvaluateAll evaluates every flag selected by filter with the given
+// properties, or every flag if filter is nil. Flags that are overridden in
+// ctx or at runtime are included even if they aren't loaded. All the flags are
+// evaluated against the same Snapshot.
+func (g *goforit) EvaluateAll(ctx context.Context, properties map[string]string, filter Filter) Evaluations {
+	return g.Snapshot().EvaluateAll(ctx, properties, filter)
+}
+
+// Snapshot evaluates flags against the flag definitions and default tags
+// that were current when it was created, so that related flags can be
+// evaluated consistently even if a refresh happens in the meantime. It is
+// safe for concurrent use.
+//
+// Apart from that, evaluating a flag with a Snapshot is just like evaluating
+// it with the Goforit that created it: overrides apply, and callbacks and
+// counters are updated.
+type Snapshot struct {
+	g           *goforit
+	flags       flagMap
+	defaultTags map[string]string
+	version     uint64
+}
+
+// Snapshot returns a Snapshot of the current flags and default tags. Creating
+// one doesn't copy anything, so it is cheap to do for each request.
+func (g *goforit) Snapshot() *Snapshot {
+	set := g.flags.loadSet()
+	return &Snapshot{
+		g:           g,
+		flags:       set.flags,
+		defaultTags: g.defaultTags.Load(),
+		version:     set.version,
+	}
+}
+
+// Version identifies the flag definitions pinned by the Snapshot. It is the
+// same as Status().Version was when the Snapshot was created.
+func (s *Snapshot) Version() uint64 {
+	return s.version
+}
+
+// Enabled returns true if the flag should be considered enabled.
+// It returns false if no flag with the specified name is found.
+func (s *Snapshot) Enabled(ctx context.Context, name string, properties map[string]string) (enabled bool) {
+	enabled, _, _, _ = s.g.evaluate(s, ctx, name, properties, false, false)
+	return
+}
+
+// Evaluate is like Enabled, but also explains why the flag has its value.
+func (s *Snapshot) Evaluate(ctx context.Context, name string, properties map[string]string) Evaluation {
+	enabled, reason, rule, err := s.g.evaluate(s, ctx, name, properties, false, false)
+	return newEvaluation(name, enabled, reason, rule, err)
+}
+
+// EvaluateAll is like Goforit.EvaluateAll, but evaluates the flags in the
+// Snapshot.
+func (s *Snapshot) EvaluateAll(ctx context.Context, properties map[string]string, filter Filter) Evaluations {
+	evaluations := make(Evaluations, len(s.flags))
+	for name, holder := range s.flags {
+		if filter == nil || filter(name, holder.flag) {
+			evaluations[name] = s.Evaluate(ctx, name, properties)
+		}
+	}
+
+	for name := range s.g.contextOverrides(ctx) {
+		if _, ok := s.flags[name]; ok {
+			continue
+		}
+		if filter == nil || filter(name, nil) {
+			evaluations[name] = s.Evaluate(ctx, name, properties)
+		}
+	}
+	for _, o := range s.g.RuntimeOverrides() {
+		if _, ok := evaluations[o.Flag]; ok {
+			continue
+		}
+		if _, ok := s.flags[o.Flag]; ok {
+			continue
+		}
+		if filter == nil || filter(o.Flag, nil) {
+			evaluations[o.Flag] = s.Evaluate(ctx, o.Flag, properties)
+		}
+	}
+	return evaluations
+}
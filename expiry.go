@@ -0,0 +1,101 @@
+package goforit
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/stripe/goforit/clamp"
+	"github.com/stripe/goforit/flags2"
+)
+
+const expiredMetricName = "goforit.flags.expired_evaluated"
+
+// expiredFlag is a loaded flag that is past its expiry time. lastReport is
+// the Unix time in nanos we last reported it being evaluated.
+type expiredFlag struct {
+	lastReport atomic.Int64
+}
+
+type expiredFlags map[string]*expiredFlag
+
+// markExpired records the loaded flags that expired before now, so that
+// evaluating them is reported.
+func (g *goforit) markExpired(now time.Time) {
+	old := g.expired.Load()
+	var expired expiredFlags
+	for name, holder := range g.flags.load() {
+		if !holder.flag.Expired(now) {
+			continue
+		}
+		if expired == nil {
+			expired = make(expiredFlags)
+		}
+		// Keep when we last reported the flag, so a refresh doesn't
+		// reset the rate limit.
+		if old != nil && (*old)[name] != nil {
+			expired[name] = (*old)[name]
+		} else {
+			expired[name] = &expiredFlag{}
+		}
+	}
+
+	if expired == nil {
+		g.expired.Store(nil)
+	} else {
+		g.expired.Store(&expired)
+	}
+}
+
+// reportExpired reports that a flag was evaluated, if it is expired. Like
+// staleness warnings, each flag is only reported once per lastAssertInterval.
+//
+//go:noinline
+func (g *goforit) reportExpired(name string, holder *flagHolder, expired expiredFlags) {
+	e, ok := expired[name]
+	if !ok {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := e.lastReport.Load()
+	if now-last < int64(lastAssertInterval) || !e.lastReport.CompareAndSwap(last, now) {
+		return
+	}
+
+	_ = g.getStats().Count(expiredMetricName, 1, []string{"flag:" + name}, 1)
+	if g.printf != nil {
+		g.printf("Flag %s expired at %s, but is still being evaluated", name,
+			holder.flag.ExpiresTime().UTC().Format(time.RFC3339))
+	}
+}
+
+// CleanupCandidate is a flag that can probably be removed from code.
+type CleanupCandidate struct {
+	Flag *flags2.Flag2
+	// Expired is true if the flag is past its expiry time.
+	Expired bool
+	// Clamp is AlwaysOn or AlwaysOff if the flag has the same value for
+	// everyone, or MayVary otherwise.
+	Clamp clamp.Clamp
+}
+
+// CleanupCandidates lists the loaded flags that are expired, or that have
+// the same value for everyone, ordered by name.
+func (g *goforit) CleanupCandidates() []CleanupCandidate {
+	now := time.Now()
+	var candidates []CleanupCandidate
+	for _, holder := range g.flags.load() {
+		expired := holder.flag.Expired(now)
+		if expired || holder.clamp != clamp.MayVary {
+			candidates = append(candidates, CleanupCandidate{
+				Flag:    holder.flag,
+				Expired: expired,
+				Clamp:   holder.clamp,
+			})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Flag.Name < candidates[j].Flag.Name
+	})
+	return candidates
+}
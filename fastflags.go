@@ -1,42 +1,79 @@
 package goforit
 
 import (
-	"github.com/stripe/goforit/flags2"
+	"sort"
 	"sync"
 	"sync/atomic"
+
+	"github.com/stripe/goforit/flags2"
 )
 
 // fastFlags is a structure for fast access to read-mostly feature flags.
 // It supports lockless reads and synchronized updates.
 type fastFlags struct {
-	flags atomic.Pointer[flagMap]
+	flags atomic.Pointer[flagSet]
 
 	writerLock sync.Mutex
 }
 
 type flagMap map[string]*flagHolder
 
+// flagSet pairs a flagMap with a version, which is incremented each time a
+// new flagMap is stored.
+type flagSet struct {
+	flags   flagMap
+	version uint64
+}
+
 // newFastFlags returns a new, empty fastFlags instance.
 func newFastFlags() *fastFlags {
 	return new(fastFlags)
 }
 
 func (ff *fastFlags) load() flagMap {
-	if flags := ff.flags.Load(); flags != nil {
-		return *flags
+	if set := ff.flags.Load(); set != nil {
+		return set.flags
 	}
 	return nil
 }
 
+// loadSet returns the current flagMap along with its version.
+func (ff *fastFlags) loadSet() flagSet {
+	if set := ff.flags.Load(); set != nil {
+		return *set
+	}
+	return flagSet{}
+}
+
+// store must be called with writerLock held.
+func (ff *fastFlags) store(flags flagMap) {
+	ff.flags.Store(&flagSet{
+		flags:   flags,
+		version: ff.loadSet().version + 1,
+	})
+}
+
 func (ff *fastFlags) Get(key string) (*flagHolder, bool) {
-	if f, ok := ff.load()[key]; ok && f != nil {
+	return ff.load().get(key)
+}
+
+func (fm flagMap) get(key string) (*flagHolder, bool) {
+	if f, ok := fm[key]; ok && f != nil {
 		return f, ok
 	} else {
 		return nil, false
 	}
 }
 
-func (ff *fastFlags) Update(refreshedFlags []*flags2.Flag2) {
+// flagChange describes a flag that was added (old is nil), removed (new is
+// nil) or redefined by an Update.
+type flagChange struct {
+	name     string
+	old, new *flags2.Flag2
+}
+
+// Update replaces the flags, and returns the changes it made ordered by name.
+func (ff *fastFlags) Update(refreshedFlags []*flags2.Flag2) []flagChange {
 	ff.writerLock.Lock()
 	defer ff.writerLock.Unlock()
 
@@ -65,11 +102,26 @@ func (ff *fastFlags) Update(refreshedFlags []*flags2.Flag2) {
 	// avoid storing the new map if it is the same as the old one.
 	// this is largely for tests in gocode which compare if flags
 	// are deeply equal in tests.
-	if changed {
-		ff.flags.Store(&newFlags)
+	if !changed {
+		return nil
 	}
-
-	return
+	ff.store(newFlags)
+
+	var changes []flagChange
+	for name, holder := range newFlags {
+		if oldHolder, ok := oldFlags[name]; !ok {
+			changes = append(changes, flagChange{name: name, new: holder.flag})
+		} else if oldHolder != holder {
+			changes = append(changes, flagChange{name: name, old: oldHolder.flag, new: holder.flag})
+		}
+	}
+	for name, oldHolder := range oldFlags {
+		if _, ok := newFlags[name]; !ok {
+			changes = append(changes, flagChange{name: name, old: oldHolder.flag})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].name < changes[j].name })
+	return changes
 }
 
 func (ff *fastFlags) storeForTesting(key string, value *flagHolder) {
@@ -84,7 +136,7 @@ func (ff *fastFlags) storeForTesting(key string, value *flagHolder) {
 
 	newFlags[key] = value
 
-	ff.flags.Store(&newFlags)
+	ff.store(newFlags)
 }
 
 func (ff *fastFlags) deleteForTesting(keyToDelete string) {
@@ -99,7 +151,7 @@ func (ff *fastFlags) deleteForTesting(keyToDelete string) {
 		}
 	}
 
-	ff.flags.Store(&newFlags)
+	ff.store(newFlags)
 }
 
 func (ff *fastFlags) Close() {
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/stripe/goforit/clamp"
 	"github.com/stripe/goforit/flags"
@@ -44,6 +45,65 @@ type Flag2 struct {
 	Seed    string  `json:"seed"`
 	Rules   []Rule2 `json:"rules"`
 	Deleted bool    `json:"deleted"`
+
+	// Metadata, which doesn't affect evaluation.
+	ID          string   `json:"_id,omitempty"`
+	Version     string   `json:"version,omitempty"`
+	Updated     float64  `json:"updated,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Expires is when the flag should have been removed from code, in
+	// seconds since the epoch like Updated, or zero if it never expires.
+	Expires float64 `json:"expires,omitempty"`
+}
+
+// flag2JSON is the JSON form of Flag2. Metadata is decoded separately from
+// the fields that affect evaluation, so that a mistyped metadata field can't
+// fail the whole document.
+type flag2JSON struct {
+	Name    string  `json:"name"`
+	Seed    string  `json:"seed"`
+	Rules   []Rule2 `json:"rules"`
+	Deleted bool    `json:"deleted"`
+
+	ID          json.RawMessage `json:"_id"`
+	Version     json.RawMessage `json:"version"`
+	Updated     json.RawMessage `json:"updated"`
+	Owner       json.RawMessage `json:"owner"`
+	Description json.RawMessage `json:"description"`
+	Tags        json.RawMessage `json:"tags"`
+	Expires     json.RawMessage `json:"expires"`
+}
+
+func (f *Flag2) UnmarshalJSON(data []byte) error {
+	var raw flag2JSON
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	*f = Flag2{Name: raw.Name, Seed: raw.Seed, Rules: raw.Rules, Deleted: raw.Deleted}
+	decodeMetadata(raw.ID, &f.ID)
+	decodeMetadata(raw.Version, &f.Version)
+	decodeMetadata(raw.Updated, &f.Updated)
+	decodeMetadata(raw.Owner, &f.Owner)
+	decodeMetadata(raw.Description, &f.Description)
+	decodeMetadata(raw.Tags, &f.Tags)
+	decodeMetadata(raw.Expires, &f.Expires)
+	return nil
+}
+
+// decodeMetadata decodes a metadata field into dst, leaving dst alone if the
+// field is missing or has the wrong type.
+func decodeMetadata[T any](data json.RawMessage, dst *T) {
+	if len(data) == 0 {
+		return
+	}
+	var v T
+	if json.Unmarshal(data, &v) == nil {
+		*dst = v
+	}
 }
 
 type JSONFormat2 struct {
@@ -92,22 +152,64 @@ func (f *Flag2) FlagName() string {
 	return f.Name
 }
 
+// UpdatedTime returns the time the flag was last updated, or the zero time
+// if it isn't known.
+func (f *Flag2) UpdatedTime() time.Time {
+	if f.Updated == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(f.Updated*float64(time.Second)))
+}
+
+// ExpiresTime returns the time the flag expires, or the zero time if it
+// never does.
+func (f *Flag2) ExpiresTime() time.Time {
+	if f.Expires == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(f.Expires*float64(time.Second)))
+}
+
+// Expired returns true if the flag has an expiry time, and it is before now.
+func (f *Flag2) Expired(now time.Time) bool {
+	return f.Expires != 0 && f.ExpiresTime().Before(now)
+}
+
+// HasTag returns true if the flag is tagged with tag.
+func (f *Flag2) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *Flag2) Enabled(rnd flags.Rand, properties, defaultTags map[string]string) (bool, error) {
+	enabled, _, err := f.Evaluate(rnd, properties, defaultTags)
+	return enabled, err
+}
+
+// Evaluate is like Enabled, but also returns the index of the rule that
+// decided the result. The index is -1 if no rule matched. If a rule fails to
+// evaluate, its index is returned along with the error.
+func (f *Flag2) Evaluate(rnd flags.Rand, properties, defaultTags map[string]string) (bool, int, error) {
 	for i := range f.Rules {
 		rule := &f.Rules[i]
 		match, err := rule.matches(properties, defaultTags)
 		if err != nil {
-			return false, err
+			return false, i, err
 		}
 		if !match {
 			continue
 		}
 
-		return rule.evaluate(rnd, f.Seed, properties, defaultTags)
+		enabled, err := rule.evaluate(rnd, f.Seed, properties, defaultTags)
+		return enabled, i, err
 	}
 
 	// If no rules match, the flag is off
-	return false, nil
+	return false, -1, nil
 }
 
 func (f *Flag2) Clamp() clamp.Clamp {
@@ -151,7 +253,7 @@ func (r *Rule2) equal(o Rule2) bool {
 }
 
 func (f *Flag2) Equal(o *Flag2) bool {
-	if f.Name != o.Name || f.Seed != o.Seed || len(f.Rules) != len(o.Rules) {
+	if f.Name != o.Name || f.Seed != o.Seed || len(f.Rules) != len(o.Rules) || f.Deleted != o.Deleted {
 		return false
 	}
 	for i := range f.Rules {
@@ -159,6 +261,20 @@ func (f *Flag2) Equal(o *Flag2) bool {
 			return false
 		}
 	}
+	return f.metadataEqual(o)
+}
+
+func (f *Flag2) metadataEqual(o *Flag2) bool {
+	if f.ID != o.ID || f.Version != o.Version || f.Updated != o.Updated ||
+		f.Owner != o.Owner || f.Description != o.Description || f.Expires != o.Expires ||
+		len(f.Tags) != len(o.Tags) {
+		return false
+	}
+	for i := range f.Tags {
+		if f.Tags[i] != o.Tags[i] {
+			return false
+		}
+	}
 	return true
 }
 
@@ -0,0 +1,109 @@
+package flags2
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ValidationError describes a problem with a JSON v2 flag document.
+type ValidationError struct {
+	// Path is a JSON path to the problem, like "$.flags[3].rules[0].percent".
+	Path    string
+	Message string
+	// Flag is the index of the flag whose definition is invalid, or -1 if
+	// the problem is with the document as a whole.
+	Flag int
+}
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors is a list of every problem found with a document.
+type ValidationErrors []ValidationError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return fmt.Sprintf("%d invalid flag definitions: %s", len(es), strings.Join(msgs, "; "))
+}
+
+// InvalidFlags returns the set of indexes of flags with invalid definitions.
+func (es ValidationErrors) InvalidFlags() map[int]bool {
+	invalid := make(map[int]bool)
+	for _, e := range es {
+		if e.Flag >= 0 {
+			invalid[e.Flag] = true
+		}
+	}
+	return invalid
+}
+
+// Validate checks the document for flags that can't be evaluated as intended,
+// and returns every problem it finds, or nil if there are none.
+//
+// Flags are invalid if they have no name, or if they have rules with a
+// percent outside [0, 1], a partial percent but nothing to hash by, or
+// predicates with no attribute or an unknown operation. Reusing a name is
+// reported as a problem with the document rather than with either flag.
+func (j *JSONFormat2) Validate() ValidationErrors {
+	var errs ValidationErrors
+	seen := make(map[string]int)
+	for i, f := range j.Flags {
+		path := fmt.Sprintf("$.flags[%d]", i)
+		if f == nil {
+			errs = append(errs, ValidationError{Path: path, Message: "flag is null", Flag: i})
+			continue
+		}
+
+		if f.Name == "" {
+			errs = append(errs, ValidationError{Path: path + ".name", Message: "name is empty", Flag: i})
+		} else if first, ok := seen[f.Name]; ok {
+			errs = append(errs, ValidationError{
+				Path:    path + ".name",
+				Message: fmt.Sprintf("name %q is already defined by $.flags[%d]", f.Name, first),
+				Flag:    -1,
+			})
+		} else {
+			seen[f.Name] = i
+		}
+
+		for r := range f.Rules {
+			errs = f.Rules[r].validate(errs, fmt.Sprintf("%s.rules[%d]", path, r), i)
+		}
+	}
+	return errs
+}
+
+func (r *Rule2) validate(errs ValidationErrors, path string, flag int) ValidationErrors {
+	if math.IsNaN(r.Percent) || r.Percent < PercentOff || r.Percent > PercentOn {
+		errs = append(errs, ValidationError{
+			Path:    path + ".percent",
+			Message: fmt.Sprintf("percent %v is not between 0 and 1", r.Percent),
+			Flag:    flag,
+		})
+	} else if r.Percent > PercentOff && r.Percent < PercentOn && r.HashBy == "" {
+		errs = append(errs, ValidationError{Path: path + ".hash_by", Message: "hash_by is empty", Flag: flag})
+	}
+
+	for i := range r.Predicates {
+		p := &r.Predicates[i]
+		ppath := fmt.Sprintf("%s.predicates[%d]", path, i)
+		if p.Attribute == "" {
+			errs = append(errs, ValidationError{Path: ppath + ".attribute", Message: "attribute is empty", Flag: flag})
+		}
+		switch p.Operation {
+		case OpIn, OpNotIn, OpIsNil, OptNotNil:
+		default:
+			errs = append(errs, ValidationError{
+				Path:    ppath + ".operation",
+				Message: fmt.Sprintf("unknown operation %q", p.Operation),
+				Flag:    flag,
+			})
+		}
+	}
+	return errs
+}
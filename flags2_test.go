@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,7 +33,7 @@ func TestFlags2Backend(t *testing.T) {
 	t.Parallel()
 
 	expectedFlags := []*flags2.Flag2{
-		{Name: "off_flag", Seed: "seed_1", Rules: []flags2.Rule2{}},
+		{Name: "off_flag", ID: "ff_1", Seed: "seed_1", Rules: []flags2.Rule2{}},
 		{
 			Name:  "go.moon.mercury",
 			Seed:  "seed_1",
@@ -50,6 +51,7 @@ func TestFlags2Backend(t *testing.T) {
 		},
 		{
 			Name: "flag5",
+			ID:   "ff_5",
 			Seed: "seed_1",
 			Rules: []flags2.Rule2{
 				{
@@ -189,3 +191,139 @@ func TestFlags2Reserialize(t *testing.T) {
 
 	require.Equal(t, flags, flags2)
 }
+
+func TestFlags2Validate(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"flags2_example.json", "flags2_acceptance.json"} {
+		buf, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		require.NoError(t, err)
+		var doc flags2.JSONFormat2
+		require.NoError(t, json.Unmarshal(buf, &doc))
+		assert.Empty(t, doc.Validate(), name)
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join("testdata", "flags2_invalid.json"))
+	require.NoError(t, err)
+	var doc flags2.JSONFormat2
+	require.NoError(t, json.Unmarshal(buf, &doc))
+
+	errs := doc.Validate()
+	assert.Equal(t, flags2.ValidationErrors{
+		{Path: "$.flags[1].name", Message: "name is empty", Flag: 1},
+		{Path: "$.flags[2].rules[0].percent", Message: "percent 1.5 is not between 0 and 1", Flag: 2},
+		{Path: "$.flags[2].rules[1].percent", Message: "percent -0.1 is not between 0 and 1", Flag: 2},
+		{Path: "$.flags[3].rules[0].hash_by", Message: "hash_by is empty", Flag: 3},
+		{Path: "$.flags[3].rules[0].predicates[0].attribute", Message: "attribute is empty", Flag: 3},
+		{Path: "$.flags[3].rules[0].predicates[1].operation", Message: `unknown operation "matches"`, Flag: 3},
+		{Path: "$.flags[4].name", Message: `name "valid_flag" is already defined by $.flags[0]`, Flag: -1},
+	}, errs)
+	assert.Equal(t, map[int]bool{1: true, 2: true, 3: true}, errs.InvalidFlags())
+	assert.Contains(t, errs.Error(), "7 invalid flag definitions")
+}
+
+func TestFlags2BackendValidation(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join("testdata", "flags2_invalid.json")
+
+	// By default, everything is loaded.
+	flags, _, err := BackendFromJSONFile2(path).Refresh()
+	require.NoError(t, err)
+	assert.Len(t, flags, 5)
+
+	// Lenient validation drops the invalid flags, but not duplicates.
+	var reported flags2.ValidationErrors
+	flags, updated, err := BackendFromJSONFile2(path,
+		JSONValidation(ValidationLenient),
+		JSONValidationCallback(func(errs flags2.ValidationErrors) { reported = errs }),
+	).Refresh()
+	require.NoError(t, err)
+	assert.Len(t, reported, 7)
+	assert.Equal(t, int64(1584642857), updated.Unix())
+	var names []string
+	for _, f := range flags {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"valid_flag", "valid_flag"}, names)
+
+	// Strict validation rejects the whole document, keeping the previous flags.
+	strict := BackendFromJSONFile2(path, JSONValidation(ValidationStrict))
+	_, _, err = strict.Refresh()
+	var errs flags2.ValidationErrors
+	require.ErrorAs(t, err, &errs)
+	assert.Len(t, errs, 7)
+
+	g, _ := testGoforit(0, BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json")), stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	assert.Error(t, g.TryRefreshFlags(strict))
+	assert.True(t, g.Enabled(context.Background(), "go.moon.mercury", nil))
+
+	_, _, err = BackendFromJSONFile2(filepath.Join("testdata", "flags2_acceptance.json"), JSONValidation(ValidationStrict)).Refresh()
+	assert.NoError(t, err)
+}
+
+func TestFlags2Metadata(t *testing.T) {
+	t.Parallel()
+
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_metadata.json"))
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	flag, ok := g.Flag("go.checkout.new_flow")
+	require.True(t, ok)
+	assert.Equal(t, "ff_10", flag.ID)
+	assert.Equal(t, "abc123", flag.Version)
+	assert.Equal(t, "checkout-team", flag.Owner)
+	assert.Equal(t, "Ramps the new checkout flow.", flag.Description)
+	assert.Equal(t, []string{"checkout", "frontend"}, flag.Tags)
+	assert.Equal(t, time.Unix(1584642857, int64(500*time.Millisecond)), flag.UpdatedTime())
+
+	flag, ok = g.Flag("go.search.index_v2")
+	require.True(t, ok)
+	assert.True(t, flag.UpdatedTime().IsZero())
+
+	_, ok = g.Flag("missing")
+	assert.False(t, ok)
+
+	// Changes to metadata alone are picked up.
+	changed := *flag
+	changed.Owner = "search-team"
+	assert.False(t, flag.Equal(&changed))
+	g.RefreshFlags(&staticBackend{flags: []*flags2.Flag2{&changed}})
+	flag, ok = g.Flag("go.search.index_v2")
+	require.True(t, ok)
+	assert.Equal(t, "search-team", flag.Owner)
+}
+
+func TestFlags2MetadataMistyped(t *testing.T) {
+	t.Parallel()
+
+	doc := `{"flags": [{
+		"name": "go.flag",
+		"seed": "seed_1",
+		"rules": [{"hash_by": "_random", "percent": 1, "predicates": []}],
+		"_id": "ff_1",
+		"version": 3,
+		"owner": {"team": "checkout"},
+		"tags": "x",
+		"updated": "yesterday"
+	}], "updated": 1584642857}`
+	flags, _, err := parseFlagsJSON2(strings.NewReader(doc))
+	require.NoError(t, err)
+	require.Len(t, flags, 1)
+
+	// Mistyped metadata is dropped, and everything else is kept.
+	flag := flags[0]
+	assert.Equal(t, "go.flag", flag.Name)
+	assert.Equal(t, clamp.AlwaysOn, flag.Clamp())
+	assert.Equal(t, "ff_1", flag.ID)
+	assert.Empty(t, flag.Version)
+	assert.Empty(t, flag.Owner)
+	assert.Nil(t, flag.Tags)
+	assert.Zero(t, flag.Updated)
+
+	// Mistyped rules still fail the document.
+	_, _, err = parseFlagsJSON2(strings.NewReader(`{"flags": [{"name": "go.flag", "rules": "x"}]}`))
+	assert.Error(t, err)
+}
@@ -3,6 +3,7 @@ package goforit
 import (
 	"context"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"sync"
@@ -43,6 +44,11 @@ type MetricsClient interface {
 
 // Goforit is the main interface for the library to check if flags enabled, refresh flags
 // customizing behavior or mocking.
+//
+// The Goforit returned by New also implements Evaluator, StatusReporter,
+// Subscriber, Inspector, Overrider and CountReporter. They are separate
+// interfaces so that mocks of Goforit don't have to implement them; use a type
+// assertion to reach them.
 type Goforit interface {
 	Enabled(ctx context.Context, name string, props map[string]string) (enabled bool)
 	RefreshFlags(backend Backend)
@@ -85,6 +91,7 @@ type goforit struct {
 	defaultTags *fastTags
 	evalCB      evaluationCallback
 	deletedCB   evaluationCallback
+	evalHooks   []EvaluationHook
 	// math.Rand is not concurrency safe, so keep a pool of them for goroutine-independent use
 	rnd                  *pooledRandFloater
 	shouldCheckStaleness atomic.Bool
@@ -94,6 +101,42 @@ type goforit struct {
 
 	// Unix time in nanos.
 	lastFlagRefreshTime atomic.Int64
+	// refreshed is set once the backend has refreshed successfully, and
+	// ready is closed at the same time
+	refreshed atomic.Bool
+	ready     chan struct{}
+
+	statusMu sync.Mutex
+	status   refreshStatus
+
+	// bootstrap loads the flags to use until the first successful refresh
+	bootstrap func() ([]*flags2.Flag2, error)
+
+	notifier *notifier
+
+	duplicatePolicy DuplicatePolicy
+	// lastDuplicates describes the duplicates found by the last refresh
+	lastDuplicates atomic.Pointer[string]
+
+	unknown unknownFlags
+
+	// expired holds the loaded flags that are past their expiry time. It is
+	// nil if there are none, so the common case only costs an atomic load.
+	expired atomic.Pointer[expiredFlags]
+
+	// counters maps each *flagHolder to its *flagCounters, if detailedCounts
+	// is set.
+	detailedCounts bool // immutable
+	counters       sync.Map
+
+	// runtimeOverrides is nil if there are none, so the common case only
+	// costs an atomic load.
+	runtimeOverrides atomic.Pointer[runtimeOverrides]
+	overridesMu      sync.Mutex
+	overrideAuditCB  func(override RuntimeOverride, cleared bool)
+	// overrideTimers wake watchers when overrides expire. They are protected
+	// by overridesMu.
+	overrideTimers map[string]*time.Timer
 
 	stats            atomic.Pointer[MetricsClient]
 	shouldCloseStats bool // immutable
@@ -104,12 +147,18 @@ type goforit struct {
 
 	mu sync.Mutex
 
+	// ctx is cancelled by done, when goforit is closed
+	ctx  context.Context
 	done func()
 
 	// lastAssert is the last time we alerted that flags may be out of date
 	lastAssert time.Time
-	// refreshTicker is used to tell the backend it should re-load state from disk
-	refreshTicker *time.Ticker
+	// refreshTicker is used to tell the backend it should re-load state from disk.
+	// If refreshJitter or backoffInitial are set, refreshLoop schedules refreshes instead.
+	refreshTicker  *time.Ticker
+	refreshJitter  float64
+	backoffInitial time.Duration
+	backoffMax     time.Duration
 	// stalenessTicker is used to tell Enabled it should check for staleness.
 	stalenessTicker *time.Ticker
 }
@@ -126,6 +175,10 @@ func newWithoutInit(stalenessTickerInterval time.Duration) (*goforit, context.Co
 		ctxOverrideEnabled: true,
 		stalenessTicker:    time.NewTicker(stalenessTickerInterval),
 		printf:             log.New(os.Stderr, "[goforit] ", log.LstdFlags).Printf,
+		ready:              make(chan struct{}),
+		notifier:           newNotifier(),
+		unknown:            unknownFlags{max: DefaultMaxUnknownFlags},
+		ctx:                ctx,
 		done:               done,
 	}
 
@@ -142,6 +195,8 @@ func newWithoutInit(stalenessTickerInterval time.Duration) (*goforit, context.Co
 		}
 	}(g.stalenessTicker)
 
+	go g.notifier.run(ctx)
+
 	return g, ctx
 }
 
@@ -223,6 +278,33 @@ func DeletedCallback(cb evaluationCallback) Option {
 	})
 }
 
+// BootstrapFlags supplies flags to use until the backend first refreshes
+// successfully, for example so that a kill switch flag defaults to on.
+func BootstrapFlags(flags []*flags2.Flag2) Option {
+	return optionFunc(func(g *goforit) {
+		g.bootstrap = func() ([]*flags2.Flag2, error) {
+			return flags, nil
+		}
+	})
+}
+
+// BootstrapJSON is like BootstrapFlags, but reads the flags from a JSON v2
+// document in fsys, such as an embed.FS compiled into the binary.
+func BootstrapJSON(fsys fs.FS, name string) Option {
+	return optionFunc(func(g *goforit) {
+		g.bootstrap = func() ([]*flags2.Flag2, error) {
+			f, err := fsys.Open(name)
+			if err != nil {
+				return nil, err
+			}
+			defer func() { _ = f.Close() }()
+
+			flags, _, err := parseFlagsJSON2(f)
+			return flags, err
+		}
+	})
+}
+
 type flagHolder struct {
 	flag          *flags2.Flag2
 	disabledCount atomic.Uint64
@@ -284,54 +366,135 @@ func (g *goforit) doStaleCheck() {
 
 // Enabled returns true if the flag should be considered enabled.
 // It returns false if no flag with the specified name is found.
+// Properties attached to ctx with WithProperties are used along with
+// the given properties, which take precedence. Both take precedence over
+// default tags.
 func (g *goforit) Enabled(ctx context.Context, name string, properties map[string]string) (enabled bool) {
+	enabled, _, _, _ = g.evaluate(nil, ctx, name, properties, false, false)
+	return
+}
+
+// EnabledWithFallback is like Enabled, but returns fallback if no flag with
+// the specified name is found and the backend has not yet refreshed
+// successfully.
+func (g *goforit) EnabledWithFallback(ctx context.Context, name string, properties map[string]string, fallback bool) (enabled bool) {
+	enabled, _, _, _ = g.evaluate(nil, ctx, name, properties, fallback, false)
+	return
+}
+
+// evaluate holds the logic shared by Enabled and Evaluate. Along with the
+// flag's value, it returns why the flag has that value, the index of the
+// rule that decided it (or -1) and any error from evaluating the rules.
+// Undefined flags evaluate to fallback until the first successful refresh.
+// If snap is non-nil, the flags and default tags pinned by it are used
+// instead of the current ones. If explain is true, the evaluation has no side
+// effects: it isn't counted, logged or passed to callbacks and hooks.
+func (g *goforit) evaluate(snap *Snapshot, ctx context.Context, name string, properties map[string]string, fallback, explain bool) (enabled bool, reason Reason, rule int, err error) {
 	enabled = false
-	flag, flagExists := g.flags.Get(name)
+	rule = -1
+	var flag *flagHolder
+	var flagExists bool
+	if snap == nil {
+		flag, flagExists = g.flags.Get(name)
+	} else {
+		flag, flagExists = snap.flags.get(name)
+	}
 
 	// nested loop is to avoid a Swap/write to the bool in the common case,
 	// but still ensure only a single Enabled caller does the staleness check.
-	if g.shouldCheckStaleness.Load() {
+	if !explain && g.shouldCheckStaleness.Load() {
 		if stillShouldCheck := g.shouldCheckStaleness.Swap(false); stillShouldCheck {
 			g.doStaleCheck()
 		}
 	}
 
-	if g.evalCB != nil {
+	if !explain && g.evalCB != nil {
 		// Wrap in a func, so `enabled` is evaluated at return-time instead of when defer is called
 		defer func() { g.evalCB(name, enabled) }()
 	}
-	if g.deletedCB != nil {
+	if !explain && g.deletedCB != nil {
 		if flag != nil && flag.flag.IsDeleted() {
 			defer func() { g.deletedCB(name, enabled) }()
 		}
 	}
+	if !explain && len(g.evalHooks) != 0 {
+		defer func() {
+			g.runEvaluationHooks(ctx, withContextProperties(ctx, properties), newEvaluation(name, enabled, reason, rule, err))
+		}()
+	}
 
 	// Check for an override.
-	if g.ctxOverrideEnabled && ctx != nil {
-		if ov, ok := ctx.Value(overrideContextKey).(overrides); ok {
-			if enabled, ok = ov[name]; ok {
-				return
+	if ov := g.contextOverrides(ctx); ov != nil {
+		if enabled, ok := ov[name]; ok {
+			if flagExists && !explain {
+				g.count(flag, counterOverride)
 			}
+			return enabled, ReasonOverride, rule, nil
 		}
 	}
+	if o, ok := g.runtimeOverride(name); ok {
+		if flagExists && !explain {
+			g.count(flag, counterOverride)
+		}
+		return o.Enabled, ReasonRuntimeOverride, rule, nil
+	}
 
 	if !flagExists {
-		enabled = false
+		enabled = fallback && !g.refreshed.Load()
+		reason = ReasonUndefined
+		if !explain {
+			g.countUnknown(name)
+		}
 		return
 	}
 
+	if expired := g.expired.Load(); expired != nil && !explain {
+		g.reportExpired(name, flag, *expired)
+	}
+
 	switch flag.clamp {
 	case clamp.AlwaysOff:
 		enabled = false
-		flag.disabledCount.Add(1)
+		reason = ReasonStatic
+		if !explain {
+			flag.disabledCount.Add(1)
+		}
 	case clamp.AlwaysOn:
 		enabled = true
-		flag.enabledCount.Add(1)
+		reason = ReasonStatic
+		if !explain {
+			flag.enabledCount.Add(1)
+		}
 	default:
-		var err error
-		enabled, err = flag.flag.Enabled(g.rnd, properties, g.defaultTags.Load())
-		if err != nil && g.printf != nil {
-			g.printf(err.Error())
+		var defaultTags map[string]string
+		if snap == nil {
+			defaultTags = g.defaultTags.Load()
+		} else {
+			defaultTags = snap.defaultTags
+		}
+		// Only look up context properties for flags that can use them.
+		enabled, rule, err = flag.flag.Evaluate(g.rnd, withContextProperties(ctx, properties), defaultTags)
+		if err != nil {
+			reason = ReasonError
+		} else if rule < 0 {
+			reason = ReasonNoRuleMatch
+		} else {
+			reason = ReasonRuleMatch
+		}
+		if explain {
+			return
+		}
+
+		switch reason {
+		case ReasonError:
+			g.count(flag, counterError)
+			if g.printf != nil {
+				g.printf(err.Error())
+			}
+		case ReasonNoRuleMatch:
+			g.count(flag, counterNoRuleMatch)
+		default:
+			g.count(flag, counterRules+rule)
 		}
 		// move setting these counts into the switch arms so that they can
 		// be predicted better for the alwaysOn/alwaysOff cases.
@@ -364,7 +527,12 @@ func (g *goforit) RefreshFlags(backend Backend) {
 func (g *goforit) TryRefreshFlags(backend Backend) error {
 	// Ask the backend for the flags
 	refreshedFlags, updated, err := backend.Refresh()
+	if err == nil {
+		refreshedFlags, err = g.resolveDuplicates(refreshedFlags)
+	}
 	if err != nil {
+		g.recordRefresh(err)
+		g.notifier.notify(nil, g.Status)
 		_ = g.getStats().Count("goforit.refreshFlags.errors", 1, nil, 1)
 		if g.printf != nil {
 			g.printf("Error refreshing flags: %s", err)
@@ -376,7 +544,10 @@ func (g *goforit) TryRefreshFlags(backend Backend) error {
 		g.lastFlagRefreshTime.Store(time.Now().UnixNano())
 	}
 
-	g.flags.Update(refreshedFlags)
+	changes := g.flags.Update(refreshedFlags)
+	g.markExpired(time.Now())
+	g.recordRefresh(nil)
+	g.notifier.notify(changes, g.Status)
 
 	g.staleCheck(updated, "goforit.flags.cache_file_age_s", 0.1,
 		"Backend is stale (%s) past our threshold (%s)", false)
@@ -384,12 +555,22 @@ func (g *goforit) TryRefreshFlags(backend Backend) error {
 	return nil
 }
 
+// Flag returns the definition of the loaded flag with the given name, including
+// its metadata. The flag must not be modified.
+func (g *goforit) Flag(name string) (*flags2.Flag2, bool) {
+	if holder, ok := g.flags.Get(name); ok {
+		return holder.flag, true
+	}
+	return nil, false
+}
+
 func (g *goforit) SetStalenessThreshold(threshold time.Duration) {
 	g.stalenessThreshold.Store(&threshold)
 }
 
 func (g *goforit) AddDefaultTags(tags map[string]string) {
 	g.defaultTags.Set(tags)
+	g.notifier.tagsChanged()
 }
 
 // init initializes the flag backend, using the provided refresh function
@@ -400,8 +581,25 @@ func (g *goforit) init(interval time.Duration, backend Backend, ctx context.Cont
 		opt.apply(g)
 	}
 
+	if g.bootstrap != nil {
+		flags, err := g.bootstrap()
+		if err == nil {
+			flags, err = g.resolveDuplicates(flags)
+		}
+		if err != nil {
+			if g.printf != nil {
+				g.printf("Error loading bootstrap flags: %s", err)
+			}
+		} else {
+			g.notifier.notify(g.flags.Update(flags), nil)
+			g.markExpired(time.Now())
+		}
+	}
+
 	g.RefreshFlags(backend)
-	if interval != 0 {
+	if interval != 0 && (g.refreshJitter > 0 || g.backoffInitial > 0) {
+		go g.refreshLoop(ctx, interval, backend)
+	} else if interval != 0 {
 		ticker := time.NewTicker(interval)
 		g.refreshTicker = ticker
 
@@ -425,6 +623,16 @@ var overrideContextKey = overrideContextKeyType{}
 
 type overrides map[string]bool
 
+// contextOverrides returns the overrides in ctx, or nil if there are none or
+// they are disabled. The result must not be modified.
+func (g *goforit) contextOverrides(ctx context.Context) overrides {
+	if !g.ctxOverrideEnabled || ctx == nil {
+		return nil
+	}
+	ov, _ := ctx.Value(overrideContextKey).(overrides)
+	return ov
+}
+
 // Override allows overriding the value of a goforit flag within a context.
 // This is mainly useful for tests.
 func Override(ctx context.Context, name string, value bool) context.Context {
@@ -438,6 +646,20 @@ func Override(ctx context.Context, name string, value bool) context.Context {
 	return context.WithValue(ctx, overrideContextKey, ov)
 }
 
+// Overrides returns a copy of the flag values set in ctx with Override, or nil
+// if there are none. It is useful to pass the overrides on to other services.
+func Overrides(ctx context.Context) map[string]bool {
+	ov, _ := ctx.Value(overrideContextKey).(overrides)
+	if len(ov) == 0 {
+		return nil
+	}
+	copied := make(map[string]bool, len(ov))
+	for k, v := range ov {
+		copied[k] = v
+	}
+	return copied
+}
+
 // Close releases resources held
 // It's still safe to call Enabled()
 func (g *goforit) Close() error {
@@ -460,6 +682,13 @@ func (g *goforit) Close() error {
 		g.done = nil
 	}
 
+	g.overridesMu.Lock()
+	for _, timer := range g.overrideTimers {
+		timer.Stop()
+	}
+	g.overrideTimers = nil
+	g.overridesMu.Unlock()
+
 	if g.shouldCloseStats {
 		_ = g.getStats().Close()
 	}
@@ -500,4 +729,12 @@ func (g *goforit) ReportCounts(callback func(name string, total, enabled uint64,
 }
 
 // for the interface compatability static check
-var _ Goforit = &goforit{}
+var (
+	_ Goforit        = &goforit{}
+	_ Evaluator      = &goforit{}
+	_ StatusReporter = &goforit{}
+	_ Subscriber     = &goforit{}
+	_ Inspector      = &goforit{}
+	_ Overrider      = &goforit{}
+	_ CountReporter  = &goforit{}
+)
@@ -14,10 +14,12 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/fstest"
 	"time"
 	"unsafe"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/goleak"
 
 	"github.com/stripe/goforit/clamp"
@@ -31,6 +33,7 @@ type mockStatsd struct {
 	histograms map[string][]float64
 	durations  map[string][]time.Duration
 	gauges     map[string]float64
+	counts     map[string]int64
 }
 
 func (m *mockStatsd) TimeInMilliseconds(name string, milli float64, tags []string, rate float64) error {
@@ -59,7 +62,14 @@ func (m *mockStatsd) Gauge(name string, val float64, _ []string, _ float64) erro
 	return nil
 }
 
-func (m *mockStatsd) Count(string, int64, []string, float64) error {
+func (m *mockStatsd) Count(name string, value int64, _ []string, _ float64) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.counts == nil {
+		m.counts = make(map[string]int64)
+	}
+	m.counts[name] += value
 	return nil
 }
 
@@ -95,6 +105,12 @@ func (m *mockStatsd) getGaugeValue(name string) float64 {
 	return m.gauges[name]
 }
 
+func (m *mockStatsd) getCountValue(name string) int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.counts[name]
+}
+
 var _ MetricsClient = &mockStatsd{}
 
 // TestFlagHolderSize ensures that the struct we use to refer to flags in the
@@ -265,7 +281,7 @@ func TestRefreshTicker(t *testing.T) {
 	defer g.Close()
 
 	g.flags.storeForTesting("go.earth.money", &flagHolder{
-		flag:  &flags2.Flag2{"go.earth.money", "seed", nil, false},
+		flag:  &flags2.Flag2{Name: "go.earth.money", Seed: "seed"},
 		clamp: clamp.MayVary,
 	})
 	g.flags.deleteForTesting("go.stars.money")
@@ -284,6 +300,323 @@ func TestRefreshTicker(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestRefreshBackoff(t *testing.T) {
+	t.Parallel()
+
+	g, _ := testGoforit(0, nil, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	RefreshBackoff(time.Second, 10*time.Second).apply(g)
+
+	assert.Equal(t, time.Minute, g.nextRefreshDelay(time.Minute))
+	expected := []time.Duration{1, 2, 4, 8, 10, 10}
+	for _, delay := range expected {
+		g.RefreshFlags(&errorBackend{})
+		assert.Equal(t, delay*time.Second, g.nextRefreshDelay(time.Minute))
+	}
+	stats := g.getStats().(*mockStatsd)
+	assert.Equal(t, float64(len(expected)), stats.getGaugeValue(consecutiveErrorsMetricName))
+
+	// Recovery resumes the usual interval straight away.
+	g.RefreshFlags(&dummyAgeBackend{})
+	assert.Equal(t, time.Minute, g.nextRefreshDelay(time.Minute))
+	assert.Equal(t, float64(0), stats.getGaugeValue(consecutiveErrorsMetricName))
+	assert.Equal(t, []float64{float64(len(expected))}, stats.getHistogramValues(failureStreakMetricName))
+}
+
+func TestRefreshJitter(t *testing.T) {
+	t.Parallel()
+
+	g, _ := testGoforit(0, nil, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	RefreshJitter(0.1).apply(g)
+
+	varied := false
+	for i := 0; i < 100; i++ {
+		delay := g.nextRefreshDelay(time.Minute)
+		assert.GreaterOrEqual(t, delay, 54*time.Second)
+		assert.LessOrEqual(t, delay, 66*time.Second)
+		varied = varied || delay != time.Minute
+	}
+	assert.True(t, varied)
+}
+
+// flakyBackend fails a fixed number of times before succeeding.
+type flakyBackend struct {
+	failures int32 // read atomically
+}
+
+func (b *flakyBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
+	if atomic.AddInt32(&b.failures, -1) >= 0 {
+		return nil, time.Time{}, errors.New("read failed")
+	}
+	return (&dummyAgeBackend{}).Refresh()
+}
+
+func TestRefreshLoopBackoff(t *testing.T) {
+	t.Parallel()
+
+	// With an hour-long interval, only backoff retries can load the flags.
+	g, _ := testGoforit(time.Hour, &flakyBackend{failures: 3}, stalenessCheckInterval,
+		RefreshBackoff(time.Millisecond, 5*time.Millisecond), RefreshJitter(0.5))
+	defer func() { _ = g.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, g.WaitForReady(ctx))
+	assert.True(t, g.Enabled(context.Background(), "go.sun.money", nil))
+}
+
+type change struct {
+	old, new *flags2.Flag2
+}
+
+func receiveChange(t *testing.T, ch <-chan change) change {
+	select {
+	case c := <-ch:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for change")
+		return change{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	all := make(chan change, 100)
+	backend := &staticBackend{flags: []*flags2.Flag2{offFlag("go.a"), offFlag("go.b"), offFlag("other")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval, ChangeCallback(func(old, new *flags2.Flag2) {
+		all <- change{old, new}
+	}))
+	defer func() { _ = g.Close() }()
+
+	// The initial load adds every flag.
+	for _, name := range []string{"go.a", "go.b", "other"} {
+		c := receiveChange(t, all)
+		assert.Nil(t, c.old)
+		assert.Equal(t, name, c.new.Name)
+	}
+
+	exact := make(chan change, 100)
+	prefix := make(chan change, 100)
+	unsubscribe := g.Subscribe("go.a", func(old, new *flags2.Flag2) { exact <- change{old, new} })
+	g.Subscribe("go.*", func(old, new *flags2.Flag2) { prefix <- change{old, new} })
+
+	backend.flags = []*flags2.Flag2{onFlag("go.a"), offFlag("other"), offFlag("go.c")}
+	g.RefreshFlags(backend)
+
+	assert.Equal(t, change{offFlag("go.a"), onFlag("go.a")}, receiveChange(t, exact))
+	assert.Equal(t, change{offFlag("go.a"), onFlag("go.a")}, receiveChange(t, prefix))
+	assert.Equal(t, change{offFlag("go.b"), nil}, receiveChange(t, prefix))
+	assert.Equal(t, change{nil, offFlag("go.c")}, receiveChange(t, prefix))
+	assert.Equal(t, change{offFlag("go.a"), onFlag("go.a")}, receiveChange(t, all))
+	assert.Equal(t, change{offFlag("go.b"), nil}, receiveChange(t, all))
+	assert.Equal(t, change{nil, offFlag("go.c")}, receiveChange(t, all))
+
+	// Refreshes that change nothing notify nobody, and unsubscribed
+	// functions aren't called.
+	g.RefreshFlags(backend)
+	unsubscribe()
+	backend.flags = []*flags2.Flag2{offFlag("go.a")}
+	g.RefreshFlags(backend)
+
+	assert.Equal(t, change{onFlag("go.a"), offFlag("go.a")}, receiveChange(t, prefix))
+	assert.Equal(t, change{offFlag("go.c"), nil}, receiveChange(t, prefix))
+	select {
+	case c := <-exact:
+		t.Fatalf("unexpected change %v", c)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestSubscribeBatch(t *testing.T) {
+	t.Parallel()
+
+	backend := &staticBackend{flags: []*flags2.Flag2{offFlag("go.a"), offFlag("go.b"), offFlag("other")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	batches := make(chan []Change, 100)
+	statuses := make(chan Status, 100)
+	g.SubscribeBatch("go.*", func(changes []Change) { batches <- changes })
+	g.SubscribeStatus(func(status Status) { statuses <- status })
+
+	receiveStatus := func() Status {
+		select {
+		case s := <-statuses:
+			return s
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for status")
+			return Status{}
+		}
+	}
+
+	// A refresh delivers its matching changes together, then its status.
+	backend.flags = []*flags2.Flag2{onFlag("go.a"), onFlag("other"), offFlag("go.c")}
+	g.RefreshFlags(backend)
+	select {
+	case changes := <-batches:
+		assert.Equal(t, []Change{
+			{Name: "go.a", Old: offFlag("go.a"), New: onFlag("go.a")},
+			{Name: "go.b", Old: offFlag("go.b")},
+			{Name: "go.c", New: offFlag("go.c")},
+		}, changes)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	status := receiveStatus()
+	assert.True(t, status.Ready)
+	assert.Equal(t, 0, status.ConsecutiveFailures)
+
+	// Failed refreshes deliver their status too, but no changes.
+	g.RefreshFlags(&errorBackend{})
+	status = receiveStatus()
+	assert.True(t, status.Ready)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	assert.Error(t, status.LastError)
+	assert.Empty(t, batches)
+}
+
+func TestSubscribeSlow(t *testing.T) {
+	t.Parallel()
+
+	backend := &staticBackend{flags: []*flags2.Flag2{offFlag("go.a")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	batches := make(chan []Change, 100)
+	statuses := make(chan Status, 100)
+	release := make(chan struct{})
+	g.SubscribeBatch("*", func(changes []Change) {
+		batches <- changes
+		<-release
+	})
+	g.SubscribeStatus(func(status Status) { statuses <- status })
+
+	backend.flags = []*flags2.Flag2{onFlag("go.a")}
+	g.RefreshFlags(backend)
+	select {
+	case changes := <-batches:
+		assert.Equal(t, []Change{{Name: "go.a", Old: offFlag("go.a"), New: onFlag("go.a")}}, changes)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+
+	// While the subscription is blocked, later refreshes are merged: go.b
+	// comes and goes, and only the last status is kept.
+	backend.flags = []*flags2.Flag2{offFlag("go.a"), onFlag("go.b")}
+	g.RefreshFlags(backend)
+	backend.flags = []*flags2.Flag2{offFlag("go.a"), onFlag("go.c")}
+	g.RefreshFlags(backend)
+	g.RefreshFlags(&errorBackend{})
+	close(release)
+
+	select {
+	case changes := <-batches:
+		assert.Equal(t, []Change{
+			{Name: "go.a", Old: onFlag("go.a"), New: offFlag("go.a")},
+			{Name: "go.c", New: onFlag("go.c")},
+		}, changes)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for changes")
+	}
+	var failures []int
+	for len(failures) < 2 {
+		select {
+		case status := <-statuses:
+			failures = append(failures, status.ConsecutiveFailures)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for statuses, got %v", failures)
+		}
+	}
+	assert.Equal(t, []int{0, 1}, failures)
+	select {
+	case status := <-statuses:
+		t.Fatalf("unexpected status %+v", status)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func receiveValue(t *testing.T, ch <-chan bool) bool {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for value")
+		return false
+	}
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+
+	allowlisted := &flags2.Flag2{Name: "go.a", Rules: []flags2.Rule2{{
+		HashBy:     flags2.HashByRandom,
+		Percent:    flags2.PercentOn,
+		Predicates: []flags2.Predicate2{{Attribute: "host", Operation: flags2.OpIn, Values: map[string]bool{"box1": true}}},
+	}}}
+	backend := &staticBackend{flags: []*flags2.Flag2{offFlag("go.a"), offFlag("go.b")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := g.Watch(ctx, "go.a", map[string]string{"user": "u1"})
+	assert.False(t, receiveValue(t, ch))
+
+	backend.flags = []*flags2.Flag2{onFlag("go.a"), offFlag("go.b")}
+	g.RefreshFlags(backend)
+	assert.True(t, receiveValue(t, ch))
+
+	// Changes that don't flip the value aren't sent.
+	backend.flags = []*flags2.Flag2{allowlisted, onFlag("go.b")}
+	g.RefreshFlags(backend)
+	assert.False(t, receiveValue(t, ch))
+	g.AddDefaultTags(map[string]string{"host": "box2"})
+	g.AddDefaultTags(map[string]string{"host": "box1"})
+	assert.True(t, receiveValue(t, ch))
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchOverrides(t *testing.T) {
+	t.Parallel()
+
+	g, _ := testGoforit(0, &staticBackend{flags: []*flags2.Flag2{offFlag("go.a")}}, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := g.Watch(ctx, "go.a", nil)
+	assert.False(t, receiveValue(t, ch))
+
+	g.SetOverride("go.a", true, 0)
+	assert.True(t, receiveValue(t, ch))
+	g.ClearOverride("go.a")
+	assert.False(t, receiveValue(t, ch))
+
+	// Expiring overrides wake watchers too.
+	g.SetOverride("go.a", true, 20*time.Millisecond)
+	assert.True(t, receiveValue(t, ch))
+	assert.False(t, receiveValue(t, ch))
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchClosed(t *testing.T) {
+	t.Parallel()
+
+	g, _ := testGoforit(0, &staticBackend{}, stalenessCheckInterval)
+	ch := g.Watch(context.Background(), "go.a", nil)
+	assert.False(t, receiveValue(t, ch))
+
+	_ = g.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
 func BenchmarkEnabled(b *testing.B) {
 	backends := []struct {
 		name    string
@@ -317,6 +650,24 @@ func BenchmarkEnabled(b *testing.B) {
 	}
 }
 
+func BenchmarkEnabledDetailedCounts(b *testing.B) {
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	props := map[string]string{"token": "id_1"}
+	for _, detailed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("detailed=%v", detailed), func(b *testing.B) {
+			g, _ := testGoforit(0, backend, stalenessCheckInterval, DetailedCounts(detailed))
+			defer g.Close()
+			b.ResetTimer()
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = g.Enabled(context.Background(), "flag5", props)
+				}
+			})
+		})
+	}
+}
+
 func BenchmarkEnabledWithArgs(b *testing.B) {
 	backends := []struct {
 		name    string
@@ -368,9 +719,9 @@ type dummyDefaultFlagsBackend struct{}
 
 func (b *dummyDefaultFlagsBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
 	testFlag := &flags2.Flag2{
-		"test",
-		"seed",
-		[]flags2.Rule2{
+		Name: "test",
+		Seed: "seed",
+		Rules: []flags2.Rule2{
 			{
 				HashBy:  flags2.HashByRandom,
 				Percent: flags2.PercentOff,
@@ -419,7 +770,6 @@ func (b *dummyDefaultFlagsBackend) Refresh() ([]*flags2.Flag2, time.Time, error)
 				},
 			},
 		},
-		false,
 	}
 	return []*flags2.Flag2{testFlag}, time.Time{}, nil
 }
@@ -521,6 +871,106 @@ func TestOverride(t *testing.T) {
 	assert.False(t, g.Enabled(ctx, "go.extra", nil))
 }
 
+func TestOverrides(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	assert.Nil(t, Overrides(ctx))
+
+	ctx = Override(Override(ctx, "go.a", true), "go.b", false)
+	ov := Overrides(ctx)
+	assert.Equal(t, map[string]bool{"go.a": true, "go.b": false}, ov)
+
+	// The result is a copy.
+	ov["go.a"] = false
+	assert.Equal(t, map[string]bool{"go.a": true, "go.b": false}, Overrides(ctx))
+}
+
+func TestWithProperties(t *testing.T) {
+	t.Parallel()
+
+	in := func(attribute string, values ...string) flags2.Predicate2 {
+		set := make(map[string]bool)
+		for _, v := range values {
+			set[v] = true
+		}
+		return flags2.Predicate2{Attribute: attribute, Operation: flags2.OpIn, Values: set}
+	}
+	flag := &flags2.Flag2{Name: "go.merchant", Rules: []flags2.Rule2{{
+		HashBy:     flags2.HashByRandom,
+		Percent:    flags2.PercentOn,
+		Predicates: []flags2.Predicate2{in("merchant", "m1"), in("host", "box1")},
+	}}}
+	backend := &staticBackend{flags: []*flags2.Flag2{flag}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	g.AddDefaultTags(map[string]string{"host": "box2", "merchant": "m1"})
+
+	ctx := context.Background()
+	assert.Nil(t, Properties(ctx))
+	assert.False(t, g.Enabled(ctx, "go.merchant", nil))
+
+	// Context properties take precedence over default tags.
+	ctx = WithProperties(ctx, map[string]string{"host": "box1", "merchant": "m2"})
+	assert.False(t, g.Enabled(ctx, "go.merchant", nil))
+	ctx = WithProperties(ctx, map[string]string{"merchant": "m1"})
+	assert.Equal(t, map[string]string{"host": "box1", "merchant": "m1"}, Properties(ctx))
+	assert.True(t, g.Enabled(ctx, "go.merchant", nil))
+
+	// Explicit properties take precedence over context properties.
+	assert.False(t, g.Enabled(ctx, "go.merchant", map[string]string{"host": "box2"}))
+	assert.True(t, g.Enabled(ctx, "go.merchant", map[string]string{"other": "x"}))
+	assert.True(t, g.Snapshot().Enabled(ctx, "go.merchant", nil))
+}
+
+func TestRuntimeOverride(t *testing.T) {
+	t.Parallel()
+
+	type audit struct {
+		override RuntimeOverride
+		cleared  bool
+	}
+	var audits []audit
+	backend := &staticBackend{flags: []*flags2.Flag2{onFlag("go.on"), offFlag("go.off")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval, OverrideAuditCallback(func(override RuntimeOverride, cleared bool) {
+		audits = append(audits, audit{override, cleared})
+	}))
+	defer func() { _ = g.Close() }()
+
+	ctx := context.Background()
+	g.SetOverride("go.on", false, 0)
+	g.SetOverride("go.missing", true, time.Hour)
+	assert.False(t, g.Enabled(ctx, "go.on", nil))
+	assert.True(t, g.Enabled(ctx, "go.missing", nil))
+	assert.Equal(t, ReasonRuntimeOverride, g.Evaluate(ctx, "go.on", nil).Reason)
+	assert.Len(t, g.EvaluateAll(ctx, nil, nil), 3)
+
+	// Context overrides take precedence.
+	assert.True(t, g.Enabled(Override(ctx, "go.on", true), "go.on", nil))
+
+	// Refreshes don't affect runtime overrides.
+	g.RefreshFlags(backend)
+	assert.False(t, g.Enabled(ctx, "go.on", nil))
+
+	overrides := g.RuntimeOverrides()
+	require.Len(t, overrides, 2)
+	assert.Equal(t, "go.missing", overrides[0].Flag)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), overrides[0].Expires, time.Minute)
+	assert.Equal(t, RuntimeOverride{Flag: "go.on"}, overrides[1])
+
+	g.ClearOverride("go.on")
+	assert.True(t, g.Enabled(ctx, "go.on", nil))
+
+	// Expired overrides no longer apply.
+	g.SetOverride("go.off", true, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.False(t, g.Enabled(ctx, "go.off", nil))
+	assert.Len(t, g.RuntimeOverrides(), 1)
+
+	assert.Len(t, audits, 4)
+	assert.Equal(t, audit{RuntimeOverride{Flag: "go.on"}, true}, audits[2])
+}
+
 func TestOverrideWithoutInit(t *testing.T) {
 	t.Parallel()
 
@@ -537,6 +987,99 @@ func TestOverrideWithoutInit(t *testing.T) {
 	assert.False(t, g.Enabled(ctx, "go.moon.mercury", nil))
 }
 
+func TestBootstrapFlags(t *testing.T) {
+	t.Parallel()
+
+	bootstrap := BootstrapFlags([]*flags2.Flag2{
+		{Name: "kill.switch", Rules: []flags2.Rule2{{HashBy: flags2.HashByRandom, Percent: flags2.PercentOn}}},
+	})
+	backend := &errorBackend{}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval, bootstrap)
+	defer func() { _ = g.Close() }()
+
+	// Before the backend succeeds, bootstrap flags and fallbacks apply.
+	assert.True(t, g.Enabled(context.Background(), "kill.switch", nil))
+	assert.False(t, g.Enabled(context.Background(), "go.moon.mercury", nil))
+	assert.True(t, g.EnabledWithFallback(context.Background(), "go.moon.mercury", nil, true))
+	assert.True(t, g.EnabledWithFallback(context.Background(), "go.sun.money", nil, true))
+	assert.False(t, g.EnabledWithFallback(Override(context.Background(), "go.sun.money", false), "go.sun.money", nil, true))
+
+	// Afterwards, only the backend's flags do.
+	assert.NoError(t, g.TryRefreshFlags(BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))))
+	assert.False(t, g.Enabled(context.Background(), "kill.switch", nil))
+	assert.False(t, g.EnabledWithFallback(context.Background(), "kill.switch", nil, true))
+	assert.False(t, g.EnabledWithFallback(context.Background(), "go.sun.money", nil, true))
+	assert.True(t, g.EnabledWithFallback(context.Background(), "go.moon.mercury", nil, false))
+}
+
+func TestBootstrapJSON(t *testing.T) {
+	t.Parallel()
+
+	fsys := fstest.MapFS{
+		"defaults.json": &fstest.MapFile{Data: []byte(`{"flags": [{"name": "kill.switch", "rules": [{"hash_by": "_random", "percent": 1.0}]}]}`)},
+		"invalid.json":  &fstest.MapFile{Data: []byte(`{"flags": `)},
+	}
+
+	g, _ := testGoforit(0, &errorBackend{}, stalenessCheckInterval, BootstrapJSON(fsys, "defaults.json"))
+	defer func() { _ = g.Close() }()
+	assert.True(t, g.Enabled(context.Background(), "kill.switch", nil))
+
+	g2, buf := testGoforit(0, &errorBackend{}, stalenessCheckInterval, BootstrapJSON(fsys, "invalid.json"))
+	defer func() { _ = g2.Close() }()
+	assert.False(t, g2.Enabled(context.Background(), "kill.switch", nil))
+	assert.Contains(t, buf.String(), "Error loading bootstrap flags")
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	g, _ := testGoforit(0, &errorBackend{}, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	assert.False(t, g.Ready())
+	status := g.Status()
+	assert.False(t, status.Ready)
+	assert.EqualError(t, status.LastError, "read failed")
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	assert.True(t, status.LastSuccess.IsZero())
+	assert.Zero(t, status.FlagCount)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, g.WaitForReady(ctx), context.DeadlineExceeded)
+
+	g.RefreshFlags(&errorBackend{})
+	assert.Equal(t, 2, g.Status().ConsecutiveFailures)
+
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	go g.RefreshFlags(backend)
+	assert.NoError(t, g.WaitForReady(context.Background()))
+
+	assert.True(t, g.Ready())
+	status = g.Status()
+	assert.True(t, status.Ready)
+	assert.Zero(t, status.ConsecutiveFailures)
+	assert.Equal(t, uint64(2), status.Failures)
+	assert.False(t, status.LastSuccess.IsZero())
+	assert.Equal(t, 5, status.FlagCount)
+
+	// The version only changes when the flags do.
+	g.RefreshFlags(backend)
+	assert.Equal(t, status.Version, g.Status().Version)
+	g.RefreshFlags(&dummyAgeBackend{})
+	assert.NotEqual(t, status.Version, g.Status().Version)
+	assert.Equal(t, 1, g.Status().FlagCount)
+}
+
+func TestWaitForReadyClosed(t *testing.T) {
+	t.Parallel()
+
+	g, _ := testGoforit(0, &errorBackend{}, stalenessCheckInterval)
+	go func() { _ = g.Close() }()
+
+	assert.ErrorIs(t, g.WaitForReady(context.Background()), ErrClosed)
+}
+
 type dummyAgeBackend struct {
 	t   time.Time
 	mtx sync.RWMutex
@@ -742,6 +1285,75 @@ func TestEvaluationCallback(t *testing.T) {
 	assert.Equal(t, 2, evaluated[flagStatus{"go.moon.mercury", true}])
 }
 
+func TestEvaluationHooks(t *testing.T) {
+	t.Parallel()
+
+	type key struct{}
+	var first, second []Evaluation
+	var properties []map[string]string
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	g := New(stalenessCheckInterval,
+		backend,
+		EvaluationHooks(func(ctx context.Context, props map[string]string, evaluation Evaluation) {
+			assert.Equal(t, "value", ctx.Value(key{}))
+			properties = append(properties, props)
+			first = append(first, evaluation)
+		}),
+		EvaluationHooks(func(ctx context.Context, properties map[string]string, evaluation Evaluation) {
+			second = append(second, evaluation)
+		}),
+		WithOwnedStats(true),
+	)
+	defer g.Close()
+
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	props := map[string]string{"token": "id_1"}
+	g.Enabled(ctx, "flag5", props)
+	g.(Evaluator).Evaluate(Override(ctx, "missing", true), "missing", props)
+	// Properties in the context are passed on with the others.
+	g.Enabled(WithProperties(ctx, map[string]string{"token": "id_2"}), "flag5", nil)
+
+	expected := []Evaluation{
+		{Flag: "flag5", Enabled: true, Reason: ReasonRuleMatch, Rule: 0},
+		{Flag: "missing", Enabled: true, Reason: ReasonOverride, Rule: -1},
+		{Flag: "flag5", Enabled: true, Reason: ReasonRuleMatch, Rule: 0},
+	}
+	assert.Equal(t, expected, first)
+	assert.Equal(t, expected, second)
+	assert.Equal(t, []map[string]string{{"token": "id_1"}, {"token": "id_1"}, {"token": "id_2"}}, properties)
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	called := 0
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	g := New(stalenessCheckInterval,
+		backend,
+		EvaluationHooks(func(context.Context, map[string]string, Evaluation) { called++ }),
+		EvaluationCallback(func(string, bool) { called++ }),
+		DetailedCounts(true),
+		WithOwnedStats(true),
+	).(*goforit)
+	defer g.Close()
+
+	ctx := context.Background()
+	props := map[string]string{"token": "id_1"}
+	assert.Equal(t, Evaluation{Flag: "flag5", Enabled: true, Reason: ReasonRuleMatch, Rule: 0}, g.Explain(ctx, "flag5", props))
+	assert.Equal(t, Evaluation{Flag: "go.moon.mercury", Enabled: true, Reason: ReasonStatic, Rule: -1}, g.Explain(ctx, "go.moon.mercury", nil))
+	assert.Equal(t, Evaluation{Flag: "missing", Reason: ReasonUndefined, Rule: -1}, g.Explain(ctx, "missing", nil))
+	assert.Equal(t, Evaluation{Flag: "flag5", Enabled: true, Reason: ReasonOverride, Rule: -1}, g.Explain(Override(ctx, "flag5", true), "flag5", nil))
+
+	// None of them were counted or passed to callbacks and hooks.
+	assert.Equal(t, 0, called)
+	g.ReportDetailedCounts(func(counts FlagCounts) {
+		t.Errorf("unexpected counts %+v", counts)
+	})
+	g.ReportUnknownCounts(func(name string, count uint64) {
+		t.Errorf("unexpected unknown flag %s", name)
+	})
+}
+
 func TestDeletionCallback(t *testing.T) {
 	t.Parallel()
 
@@ -812,6 +1424,349 @@ func TestGoforit_ReportCounts(t *testing.T) {
 	assert.Greater(t, duration, time.Duration(0))
 }
 
+func TestGoforit_ReportDetailedCounts(t *testing.T) {
+	t.Parallel()
+
+	users := func(users ...string) []flags2.Predicate2 {
+		values := make(map[string]bool)
+		for _, user := range users {
+			values[user] = true
+		}
+		return []flags2.Predicate2{{Attribute: "user", Operation: flags2.OpIn, Values: values}}
+	}
+	ramp := &flags2.Flag2{Name: "go.ramp", Rules: []flags2.Rule2{
+		{HashBy: flags2.HashByRandom, Percent: flags2.PercentOn, Predicates: users("u1")},
+		{HashBy: flags2.HashByRandom, Percent: flags2.PercentOff, Predicates: users("u2")},
+		{HashBy: flags2.HashByRandom, Percent: flags2.PercentOn, Predicates: []flags2.Predicate2{{Attribute: "user", Operation: "bogus"}}},
+	}}
+	allowlist := &flags2.Flag2{Name: "go.allowlist", Rules: []flags2.Rule2{
+		{HashBy: flags2.HashByRandom, Percent: flags2.PercentOn, Predicates: users("u1")},
+	}}
+	backend := &staticBackend{flags: []*flags2.Flag2{ramp, allowlist, onFlag("go.on"), offFlag("go.unused")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval, DetailedCounts(true))
+	defer func() { _ = g.Close() }()
+
+	ctx := context.Background()
+	assert.True(t, g.Enabled(ctx, "go.ramp", map[string]string{"user": "u1"}))
+	assert.True(t, g.Enabled(ctx, "go.ramp", map[string]string{"user": "u1"}))
+	assert.False(t, g.Enabled(ctx, "go.ramp", map[string]string{"user": "u2"}))
+	assert.False(t, g.Enabled(ctx, "go.ramp", map[string]string{"user": "u3"}))
+	assert.False(t, g.Enabled(ctx, "go.allowlist", map[string]string{"user": "u2"}))
+	assert.True(t, g.Enabled(Override(ctx, "go.allowlist", true), "go.allowlist", nil))
+	assert.True(t, g.Enabled(ctx, "go.on", nil))
+
+	counts := make(map[string]FlagCounts)
+	g.ReportDetailedCounts(func(c FlagCounts) {
+		counts[c.Name] = c
+	})
+	assert.Equal(t, map[string]FlagCounts{
+		"go.ramp":      {Name: "go.ramp", Total: 4, Enabled: 2, Errors: 1, Rules: []uint64{2, 1, 0}},
+		"go.allowlist": {Name: "go.allowlist", Total: 1, Overrides: 1, NoRuleMatch: 1, Rules: []uint64{0}},
+		"go.on":        {Name: "go.on", Total: 1, Enabled: 1},
+	}, counts)
+
+	// Counts are reset by reporting.
+	g.ReportDetailedCounts(func(c FlagCounts) {
+		t.Errorf("unexpected counts for %s", c.Name)
+	})
+
+	// Counters of removed flags are dropped.
+	assert.False(t, g.Enabled(ctx, "go.ramp", map[string]string{"user": "u3"}))
+	backend.flags = []*flags2.Flag2{allowlist}
+	g.RefreshFlags(backend)
+	g.ReportDetailedCounts(func(c FlagCounts) {})
+	var counted []string
+	g.counters.Range(func(key, _ interface{}) bool {
+		counted = append(counted, key.(*flagHolder).flag.Name)
+		return true
+	})
+	assert.Equal(t, []string{"go.allowlist"}, counted)
+
+	// Without DetailedCounts, only the totals are counted.
+	g2, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g2.Close() }()
+	assert.True(t, g2.Enabled(Override(ctx, "go.allowlist", true), "go.allowlist", nil))
+	assert.False(t, g2.Enabled(ctx, "go.allowlist", map[string]string{"user": "u2"}))
+	counts = make(map[string]FlagCounts)
+	g2.ReportDetailedCounts(func(c FlagCounts) {
+		counts[c.Name] = c
+	})
+	assert.Equal(t, map[string]FlagCounts{
+		"go.allowlist": {Name: "go.allowlist", Total: 1},
+	}, counts)
+}
+
+func TestGoforit_ReportUnknownCounts(t *testing.T) {
+	t.Parallel()
+
+	var unknown []string
+	var mu sync.Mutex
+	backend := &staticBackend{flags: []*flags2.Flag2{onFlag("go.known")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval, MaxUnknownFlags(2), UnknownFlagCallback(func(flag string) {
+		mu.Lock()
+		defer mu.Unlock()
+		unknown = append(unknown, flag)
+	}))
+	defer func() { _ = g.Close() }()
+
+	ctx := context.Background()
+	assert.True(t, g.Enabled(ctx, "go.known", nil))
+	assert.False(t, g.Enabled(ctx, "go.typo", nil))
+	assert.False(t, g.Enabled(ctx, "go.typo", nil))
+	assert.False(t, g.Enabled(ctx, "go.deleted", nil))
+	assert.False(t, g.Enabled(ctx, "go.third", nil))
+	// Overridden flags aren't unknown.
+	assert.True(t, g.Enabled(Override(ctx, "go.overridden", true), "go.overridden", nil))
+
+	counts := make(map[string]uint64)
+	g.ReportUnknownCounts(func(name string, count uint64) {
+		counts[name] = count
+	})
+	assert.Equal(t, map[string]uint64{"go.typo": 2, "go.deleted": 1}, counts)
+	assert.Equal(t, int64(1), g.getStats().(*mockStatsd).getCountValue(unknownDroppedMetricName))
+	mu.Lock()
+	assert.Equal(t, []string{"go.typo", "go.deleted"}, unknown)
+	mu.Unlock()
+
+	// Reporting resets the counts, making room for new names.
+	assert.False(t, g.Enabled(ctx, "go.third", nil))
+	counts = make(map[string]uint64)
+	g.ReportUnknownCounts(func(name string, count uint64) {
+		counts[name] = count
+	})
+	assert.Equal(t, map[string]uint64{"go.third": 1}, counts)
+	mu.Lock()
+	assert.Equal(t, []string{"go.typo", "go.deleted", "go.third"}, unknown)
+	mu.Unlock()
+}
+
+func TestUnknownWithBootstrap(t *testing.T) {
+	t.Parallel()
+
+	var unknown []string
+	g, _ := testGoforit(0, &errorBackend{}, stalenessCheckInterval,
+		BootstrapFlags([]*flags2.Flag2{onFlag("kill.switch")}),
+		UnknownFlagCallback(func(flag string) { unknown = append(unknown, flag) }))
+	defer func() { _ = g.Close() }()
+
+	// Flags that only the backend defines aren't unknown until it loads.
+	assert.False(t, g.Ready())
+	assert.False(t, g.Enabled(context.Background(), "real_flag", nil))
+	assert.Empty(t, unknown)
+	g.ReportUnknownCounts(func(name string, count uint64) {
+		t.Errorf("unexpected unknown flag %s", name)
+	})
+}
+
+func BenchmarkEnabledUnknown(b *testing.B) {
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer g.Close()
+	b.ResetTimer()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = g.Enabled(context.Background(), "go.not_shipped_yet", nil)
+		}
+	})
+}
+
+func TestUnknownBeforeLoad(t *testing.T) {
+	t.Parallel()
+
+	g, _ := newWithoutInit(stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	assert.False(t, g.Enabled(context.Background(), "go.anything", nil))
+	g.ReportUnknownCounts(func(name string, count uint64) {
+		t.Errorf("unexpected unknown flag %s", name)
+	})
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	ctx := context.Background()
+	assert.Equal(t, Evaluation{Flag: "go.moon.mercury", Enabled: true, Reason: ReasonStatic, Rule: -1},
+		g.Evaluate(ctx, "go.moon.mercury", nil))
+	assert.Equal(t, Evaluation{Flag: "go.sun.money", Enabled: false, Reason: ReasonStatic, Rule: -1},
+		g.Evaluate(ctx, "go.sun.money", nil))
+	assert.Equal(t, Evaluation{Flag: "non.existent", Enabled: false, Reason: ReasonUndefined, Rule: -1},
+		g.Evaluate(ctx, "non.existent", nil))
+	assert.Equal(t, Evaluation{Flag: "flag5", Enabled: true, Reason: ReasonRuleMatch, Rule: 0},
+		g.Evaluate(ctx, "flag5", map[string]string{"token": "id_1"}))
+	assert.Equal(t, Evaluation{Flag: "flag5", Enabled: false, Reason: ReasonNoRuleMatch, Rule: -1},
+		g.Evaluate(ctx, "flag5", nil))
+	assert.Equal(t, Evaluation{Flag: "go.sun.money", Enabled: true, Reason: ReasonOverride, Rule: -1},
+		g.Evaluate(Override(ctx, "go.sun.money", true), "go.sun.money", nil))
+
+	g.flags.storeForTesting("bad", &flagHolder{
+		flag: &flags2.Flag2{
+			Name:  "bad",
+			Rules: []flags2.Rule2{{Predicates: []flags2.Predicate2{{Attribute: "a", Operation: "bogus"}}}},
+		},
+		clamp: clamp.MayVary,
+	})
+	e := g.Evaluate(ctx, "bad", nil)
+	assert.False(t, e.Enabled)
+	assert.Equal(t, ReasonError, e.Reason)
+	assert.Equal(t, 0, e.Rule)
+	assert.Contains(t, e.Error, "bogus")
+}
+
+func TestEvaluateAll(t *testing.T) {
+	t.Parallel()
+
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_example.json"))
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	ctx := context.Background()
+	evaluations := g.EvaluateAll(ctx, map[string]string{"token": "id_1"}, nil)
+	assert.Len(t, evaluations, 5)
+	assert.True(t, evaluations["go.moon.mercury"].Enabled)
+	assert.False(t, evaluations["go.sun.money"].Enabled)
+	assert.True(t, evaluations["flag5"].Enabled)
+	assert.Equal(t, ReasonRuleMatch, evaluations["flag5"].Reason)
+
+	// Overrides apply, even to flags that aren't loaded.
+	ctx = Override(ctx, "go.moon.mercury", false)
+	ctx = Override(ctx, "go.moon.extra", true)
+	ctx = Override(ctx, "other.extra", true)
+	evaluations = g.EvaluateAll(ctx, nil, PrefixFilter("go.moon."))
+	assert.Equal(t, map[string]bool{"go.moon.mercury": false, "go.moon.extra": true}, evaluations.Values())
+	assert.Equal(t, ReasonOverride, evaluations["go.moon.extra"].Reason)
+
+	// Evaluations are counted.
+	counts := make(map[string]uint64)
+	g.ReportCounts(func(name string, total, enabled uint64, isDeleted bool) {
+		counts[name] = total
+	})
+	assert.Equal(t, map[string]uint64{
+		"go.moon.mercury": 1,
+		"go.stars.money":  1,
+		"go.sun.money":    1,
+		"off_flag":        1,
+		"flag5":           1,
+	}, counts)
+}
+
+func TestEvaluateAllTagFilter(t *testing.T) {
+	t.Parallel()
+
+	backend := BackendFromJSONFile2(filepath.Join("testdata", "flags2_metadata.json"))
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	// Flags that aren't loaded have no tags, so overrides of them are left out.
+	ctx := Override(context.Background(), "go.checkout.extra", true)
+	evaluations := g.EvaluateAll(ctx, nil, TagFilter("checkout"))
+	assert.Len(t, evaluations, 2)
+	assert.Contains(t, evaluations, "go.checkout.new_flow")
+	assert.Contains(t, evaluations, "go.checkout.kill_switch")
+
+	assert.Empty(t, g.EvaluateAll(ctx, nil, TagFilter("missing")))
+}
+
+func TestSnapshot(t *testing.T) {
+	t.Parallel()
+
+	allowlisted := &flags2.Flag2{Name: "go.b", Rules: []flags2.Rule2{{
+		HashBy:     flags2.HashByRandom,
+		Percent:    flags2.PercentOn,
+		Predicates: []flags2.Predicate2{{Attribute: "host", Operation: flags2.OpIn, Values: map[string]bool{"box1": true}}},
+	}}}
+	backend := &staticBackend{flags: []*flags2.Flag2{onFlag("go.a"), allowlisted}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	g.AddDefaultTags(map[string]string{"host": "box1"})
+
+	ctx := context.Background()
+	snap := g.Snapshot()
+	assert.Equal(t, g.Status().Version, snap.Version())
+
+	backend.flags = []*flags2.Flag2{offFlag("go.a"), allowlisted, onFlag("go.c")}
+	g.RefreshFlags(backend)
+	g.AddDefaultTags(map[string]string{"host": "box2"})
+
+	// The snapshot still sees the old flags and tags.
+	assert.True(t, snap.Enabled(ctx, "go.a", nil))
+	assert.True(t, snap.Enabled(ctx, "go.b", nil))
+	assert.False(t, snap.Enabled(ctx, "go.c", nil))
+	assert.Equal(t, ReasonUndefined, snap.Evaluate(ctx, "go.c", nil).Reason)
+	assert.Len(t, snap.EvaluateAll(ctx, nil, nil), 2)
+	assert.True(t, snap.Enabled(Override(ctx, "go.c", true), "go.c", nil))
+
+	// But Goforit sees the new ones.
+	assert.False(t, g.Enabled(ctx, "go.a", nil))
+	assert.False(t, g.Enabled(ctx, "go.b", nil))
+	assert.True(t, g.Enabled(ctx, "go.c", nil))
+	assert.NotEqual(t, g.Status().Version, snap.Version())
+	assert.Equal(t, g.Status().Version, g.Snapshot().Version())
+}
+
+func TestExpiredFlags(t *testing.T) {
+	t.Parallel()
+
+	expired := onFlag("go.expired")
+	expired.Expires = float64(time.Now().Add(-time.Hour).Unix())
+	future := onFlag("go.future")
+	future.Expires = float64(time.Now().Add(time.Hour).Unix())
+	varies := &flags2.Flag2{Name: "go.varies", Rules: []flags2.Rule2{{HashBy: "token", Percent: 0.5}}}
+	backend := &staticBackend{flags: []*flags2.Flag2{expired, future, varies, offFlag("go.off")}}
+	g, buf := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+
+	// Only the first evaluation within the interval is reported.
+	for i := 0; i < 3; i++ {
+		assert.True(t, g.Enabled(context.Background(), "go.expired", nil))
+		assert.True(t, g.Enabled(context.Background(), "go.future", nil))
+	}
+	assert.Equal(t, int64(1), g.getStats().(*mockStatsd).getCountValue(expiredMetricName))
+	assert.Equal(t, 1, strings.Count(buf.String(), "Flag go.expired expired at"))
+	assert.NotContains(t, buf.String(), "go.future")
+
+	// Refreshing doesn't reset the rate limit.
+	backend.flags = append(backend.flags, &flags2.Flag2{Name: "go.new", Rules: varies.Rules})
+	g.RefreshFlags(backend)
+	assert.True(t, g.Enabled(context.Background(), "go.expired", nil))
+	assert.Equal(t, int64(1), g.getStats().(*mockStatsd).getCountValue(expiredMetricName))
+
+	candidates := g.CleanupCandidates()
+	assert.Len(t, candidates, 3)
+	assert.Equal(t, CleanupCandidate{Flag: expired, Expired: true, Clamp: clamp.AlwaysOn}, candidates[0])
+	assert.Equal(t, CleanupCandidate{Flag: future, Clamp: clamp.AlwaysOn}, candidates[1])
+	assert.Equal(t, "go.off", candidates[2].Flag.Name)
+	assert.Equal(t, clamp.AlwaysOff, candidates[2].Clamp)
+}
+
+func TestFlagStates(t *testing.T) {
+	t.Parallel()
+
+	backend := &staticBackend{flags: []*flags2.Flag2{onFlag("go.b"), offFlag("go.a")}}
+	g, _ := testGoforit(0, backend, stalenessCheckInterval)
+	defer func() { _ = g.Close() }()
+	g.AddDefaultTags(map[string]string{"host": "box1"})
+
+	assert.True(t, g.Enabled(context.Background(), "go.b", nil))
+	states := g.FlagStates()
+	assert.Equal(t, []FlagState{
+		{Flag: backend.flags[1], Clamp: clamp.AlwaysOff},
+		{Flag: backend.flags[0], Clamp: clamp.AlwaysOn, Total: 1, Enabled: 1},
+	}, states)
+	// Reading the counts doesn't reset them.
+	assert.Equal(t, states, g.FlagStates())
+
+	tags := g.DefaultTags()
+	assert.Equal(t, map[string]string{"host": "box1"}, tags)
+	tags["host"] = "box2"
+	assert.Equal(t, map[string]string{"host": "box1"}, g.DefaultTags())
+}
+
 func TestDefaultFastFlags(t *testing.T) {
 	ff := &fastFlags{}
 
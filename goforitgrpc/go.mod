@@ -0,0 +1,27 @@
+module github.com/stripe/goforit/goforitgrpc
+
+go 1.19
+
+require (
+	github.com/stretchr/testify v1.8.1
+	// Bumped to the root release with the APIs used here once it is tagged;
+	// see Releasing in README.md. Until then, the replace below is used.
+	github.com/stripe/goforit v0.0.0
+	google.golang.org/grpc v1.56.3
+)
+
+require (
+	github.com/DataDog/datadog-go v4.8.3+incompatible // indirect
+	github.com/Microsoft/go-winio v0.5.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.9.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/stripe/goforit => ../
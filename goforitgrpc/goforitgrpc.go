@@ -0,0 +1,288 @@
+// Package goforitgrpc provides gRPC interceptors that carry goforit context
+// overrides, and optionally evaluation properties, from one service to the
+// next.
+//
+// Client interceptors write the overrides in an outgoing call's context to
+// its metadata, and server interceptors restore them into the incoming
+// call's context with goforit.Override. Properties are restored with
+// goforit.WithProperties:
+//
+//	conn, err := grpc.Dial(target,
+//		grpc.WithUnaryInterceptor(goforitgrpc.UnaryClientInterceptor(goforitgrpc.Allow("go.checkout.*"))),
+//		grpc.WithStreamInterceptor(goforitgrpc.StreamClientInterceptor(goforitgrpc.Allow("go.checkout.*"))),
+//	)
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(goforitgrpc.UnaryServerInterceptor(goforitgrpc.Allow("go.checkout.*"))),
+//		grpc.StreamInterceptor(goforitgrpc.StreamServerInterceptor(goforitgrpc.Allow("go.checkout.*"))),
+//	)
+//
+// Overrides are encoded like the HTTP middleware's header, as "a=on,b=off",
+// and properties are URL encoded.
+package goforitgrpc
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/middleware"
+)
+
+const (
+	// DefaultMetadataKey is the metadata key overrides are carried in by
+	// default.
+	DefaultMetadataKey = "goforit-overrides"
+	// DefaultPropertiesMetadataKey is the metadata key properties are
+	// carried in by default.
+	DefaultPropertiesMetadataKey = "goforit-properties"
+	// DefaultMaxSize is the default limit on the size of the encoded
+	// overrides, and of the encoded properties, in bytes.
+	DefaultMaxSize = 4096
+)
+
+// Option configures an interceptor.
+type Option func(c *config)
+
+// Allow adds flags to the allowlist of flags whose overrides are propagated.
+// If a name ends with "*", every flag whose name starts with the rest of it
+// is allowed. By default no overrides are propagated.
+func Allow(flags ...string) Option {
+	return func(c *config) {
+		c.allowlist = append(c.allowlist, flags...)
+	}
+}
+
+// MaxSize limits the size of the encoded overrides, and of the encoded
+// properties. Clients leave out the entries that don't fit, and servers
+// ignore metadata that is larger. The default is DefaultMaxSize.
+func MaxSize(bytes int) Option {
+	return func(c *config) {
+		c.maxSize = bytes
+	}
+}
+
+// MetadataKey sets the metadata key overrides are carried in. The default is
+// DefaultMetadataKey.
+func MetadataKey(key string) Option {
+	return func(c *config) {
+		c.key = strings.ToLower(key)
+	}
+}
+
+// PropagateProperties propagates the named properties attached to contexts
+// with goforit.WithProperties. By default no properties are propagated.
+func PropagateProperties(names ...string) Option {
+	return func(c *config) {
+		if c.properties == nil {
+			c.properties = make(map[string]bool)
+		}
+		for _, name := range names {
+			c.properties[name] = true
+		}
+	}
+}
+
+// PropertiesMetadataKey sets the metadata key properties are carried in. The
+// default is DefaultPropertiesMetadataKey.
+func PropertiesMetadataKey(key string) Option {
+	return func(c *config) {
+		c.propertiesKey = strings.ToLower(key)
+	}
+}
+
+type config struct {
+	key           string
+	propertiesKey string
+	maxSize       int
+	allowlist     middleware.Allowlist
+	properties    map[string]bool
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{key: DefaultMetadataKey, propertiesKey: DefaultPropertiesMetadataKey, maxSize: DefaultMaxSize}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// outgoing adds the allowed overrides and properties in ctx to its outgoing
+// metadata.
+func (c *config) outgoing(ctx context.Context) context.Context {
+	return c.outgoingProperties(c.outgoingOverrides(ctx))
+}
+
+func (c *config) outgoingOverrides(ctx context.Context) context.Context {
+	overrides := goforit.Overrides(ctx)
+	if len(overrides) == 0 {
+		return ctx
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		if c.allowlist.Allows(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		entry := name + "=off"
+		if overrides[name] {
+			entry = name + "=on"
+		}
+		if b.Len() > 0 {
+			entry = "," + entry
+		}
+		if b.Len()+len(entry) > c.maxSize {
+			continue
+		}
+		b.WriteString(entry)
+	}
+	if b.Len() == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, c.key, b.String())
+}
+
+func (c *config) outgoingProperties(ctx context.Context) context.Context {
+	props := goforit.Properties(ctx)
+	if len(props) == 0 || len(c.properties) == 0 {
+		return ctx
+	}
+
+	names := make([]string, 0, len(props))
+	for name := range props {
+		if c.properties[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		entry := url.QueryEscape(name) + "=" + url.QueryEscape(props[name])
+		if b.Len() > 0 {
+			entry = "&" + entry
+		}
+		if b.Len()+len(entry) > c.maxSize {
+			continue
+		}
+		b.WriteString(entry)
+	}
+	if b.Len() == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, c.propertiesKey, b.String())
+}
+
+// incoming applies the allowed overrides and properties in ctx's incoming
+// metadata to it. Metadata that is too large or malformed is ignored.
+func (c *config) incoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return c.incomingProperties(c.incomingOverrides(ctx, md), md)
+}
+
+func (c *config) incomingOverrides(ctx context.Context, md metadata.MD) context.Context {
+	values := md.Get(c.key)
+	if len(values) == 0 {
+		return ctx
+	}
+	encoded := strings.Join(values, ",")
+	if len(encoded) > c.maxSize {
+		return ctx
+	}
+	overrides, err := middleware.Parse(encoded)
+	if err != nil {
+		return ctx
+	}
+	for _, o := range overrides {
+		if c.allowlist.Allows(o.Flag) {
+			ctx = goforit.Override(ctx, o.Flag, o.Enabled)
+		}
+	}
+	return ctx
+}
+
+func (c *config) incomingProperties(ctx context.Context, md metadata.MD) context.Context {
+	if len(c.properties) == 0 {
+		return ctx
+	}
+	values := md.Get(c.propertiesKey)
+	if len(values) == 0 {
+		return ctx
+	}
+	encoded := strings.Join(values, "&")
+	if len(encoded) > c.maxSize {
+		return ctx
+	}
+	query, err := url.ParseQuery(encoded)
+	if err != nil {
+		return ctx
+	}
+	props := make(map[string]string, len(query))
+	for name := range query {
+		if c.properties[name] {
+			props[name] = query.Get(name)
+		}
+	}
+	if len(props) == 0 {
+		return ctx
+	}
+	return goforit.WithProperties(ctx, props)
+}
+
+// UnaryClientInterceptor propagates the overrides and properties in each
+// call's context.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		return invoker(c.outgoing(ctx), method, req, reply, cc, callOpts...)
+	}
+}
+
+// StreamClientInterceptor propagates the overrides and properties in each
+// stream's context.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(c.outgoing(ctx), desc, cc, method, callOpts...)
+	}
+}
+
+// UnaryServerInterceptor restores propagated overrides and properties into
+// each call's context.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	c := newConfig(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(c.incoming(ctx), req)
+	}
+}
+
+// StreamServerInterceptor restores propagated overrides and properties into
+// each stream's context.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	c := newConfig(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: c.incoming(ss.Context())})
+	}
+}
+
+// serverStream replaces the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,162 @@
+package goforitgrpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/stripe/goforit"
+)
+
+// roundTrip sends ctx's overrides through a client interceptor, and returns
+// the context a server interceptor gives the handler.
+func roundTrip(t *testing.T, ctx context.Context, client, server []Option) context.Context {
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	require.NoError(t, UnaryClientInterceptor(client...)(ctx, "/test", nil, nil, nil, invoker))
+
+	var handled context.Context
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		handled = ctx
+		return nil, nil
+	}
+	_, err := UnaryServerInterceptor(server...)(metadata.NewIncomingContext(context.Background(), md), nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	return handled
+}
+
+func TestUnary(t *testing.T) {
+	t.Parallel()
+
+	ctx := goforit.Override(context.Background(), "go.a", true)
+	ctx = goforit.Override(ctx, "go.b.c", false)
+	ctx = goforit.Override(ctx, "go.secret", true)
+
+	got := roundTrip(t, ctx, []Option{Allow("go.a", "go.b.*")}, []Option{Allow("go.*")})
+	assert.Equal(t, map[string]bool{"go.a": true, "go.b.c": false}, goforit.Overrides(got))
+
+	// The server's allowlist applies too.
+	got = roundTrip(t, ctx, []Option{Allow("go.*")}, []Option{Allow("go.a")})
+	assert.Equal(t, map[string]bool{"go.a": true}, goforit.Overrides(got))
+
+	// Nothing is propagated by default.
+	got = roundTrip(t, ctx, nil, []Option{Allow("go.*")})
+	assert.Nil(t, goforit.Overrides(got))
+}
+
+func TestMaxSize(t *testing.T) {
+	t.Parallel()
+
+	ctx := goforit.Override(context.Background(), "go.a", true)
+	ctx = goforit.Override(ctx, "go.b", false)
+
+	// Clients leave out what doesn't fit.
+	got := roundTrip(t, ctx, []Option{Allow("go.*"), MaxSize(len("go.a=on"))}, []Option{Allow("go.*")})
+	assert.Equal(t, map[string]bool{"go.a": true}, goforit.Overrides(got))
+
+	// Servers ignore metadata that is too large.
+	got = roundTrip(t, ctx, []Option{Allow("go.*")}, []Option{Allow("go.*"), MaxSize(10)})
+	assert.Nil(t, goforit.Overrides(got))
+}
+
+func TestMalformedMetadata(t *testing.T) {
+	t.Parallel()
+
+	md := metadata.Pairs(DefaultMetadataKey, "go.a=maybe")
+	c := newConfig([]Option{Allow("go.*")})
+	assert.Nil(t, goforit.Overrides(c.incoming(metadata.NewIncomingContext(context.Background(), md))))
+}
+
+func TestProperties(t *testing.T) {
+	t.Parallel()
+
+	ctx := goforit.WithProperties(context.Background(), map[string]string{"user": "u 1&2", "merchant": "m1", "secret": "s"})
+
+	got := roundTrip(t, ctx, []Option{PropagateProperties("user", "merchant")}, []Option{PropagateProperties("user", "merchant", "secret")})
+	assert.Equal(t, map[string]string{"user": "u 1&2", "merchant": "m1"}, goforit.Properties(got))
+
+	// The server's allowlist applies too.
+	got = roundTrip(t, ctx, []Option{PropagateProperties("user", "merchant")}, []Option{PropagateProperties("user")})
+	assert.Equal(t, map[string]string{"user": "u 1&2"}, goforit.Properties(got))
+
+	// Nothing is propagated by default.
+	got = roundTrip(t, ctx, nil, []Option{PropagateProperties("user")})
+	assert.Nil(t, goforit.Properties(got))
+
+	// Clients leave out what doesn't fit.
+	got = roundTrip(t, ctx, []Option{PropagateProperties("user", "merchant"), MaxSize(len("merchant=m1"))}, []Option{PropagateProperties("user", "merchant")})
+	assert.Equal(t, map[string]string{"merchant": "m1"}, goforit.Properties(got))
+
+	// Properties and overrides travel together.
+	ctx = goforit.Override(ctx, "go.a", true)
+	got = roundTrip(t, ctx, []Option{Allow("go.*"), PropagateProperties("user")}, []Option{Allow("go.*"), PropagateProperties("user")})
+	assert.Equal(t, map[string]bool{"go.a": true}, goforit.Overrides(got))
+	assert.Equal(t, map[string]string{"user": "u 1&2"}, goforit.Properties(got))
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	streamed := make(chan context.Context, 1)
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(Allow("go.*"))),
+		grpc.StreamInterceptor(StreamServerInterceptor(Allow("go.*"))),
+	)
+	healthpb.RegisterHealthServer(server, &overrideHealth{Server: health.NewServer(), streamed: streamed})
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(Allow("go.*"))),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(Allow("go.*"))),
+	)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	client := healthpb.NewHealthClient(conn)
+
+	ctx := goforit.Override(context.Background(), "go.a", true)
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "go.a"})
+	require.NoError(t, err)
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "go.a"})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"go.a": true}, goforit.Overrides(<-streamed))
+}
+
+// overrideHealth reports a service as serving if a flag with its name is
+// overridden on.
+type overrideHealth struct {
+	*health.Server
+	streamed chan<- context.Context
+}
+
+func (h *overrideHealth) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	status := healthpb.HealthCheckResponse_NOT_SERVING
+	if goforit.Overrides(ctx)[req.Service] {
+		status = healthpb.HealthCheckResponse_SERVING
+	}
+	return &healthpb.HealthCheckResponse{Status: status}, nil
+}
+
+func (h *overrideHealth) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	h.streamed <- stream.Context()
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
@@ -0,0 +1,81 @@
+package goforittest
+
+import (
+	"testing"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/flags2"
+)
+
+// Load reads flags from a file in the JSON format read by
+// goforit.BackendFromJSONFile2, and fails the test if it can't.
+func Load(t testing.TB, filename string) []*flags2.Flag2 {
+	t.Helper()
+	flags, _, err := goforit.BackendFromJSONFile2(filename).Refresh()
+	if err != nil {
+		t.Fatalf("loading flags from %s: %s", filename, err)
+	}
+	return flags
+}
+
+// Flag returns a flag with the given name and rules. The first rule whose
+// predicates match decides its value, and it is off if none do.
+func Flag(name string, rules ...flags2.Rule2) *flags2.Flag2 {
+	return &flags2.Flag2{Name: name, Seed: name, Rules: rules}
+}
+
+// On returns a flag that is always on.
+func On(name string) *flags2.Flag2 {
+	return Flag(name, Always(true))
+}
+
+// Off returns a flag that is always off.
+func Off(name string) *flags2.Flag2 {
+	return Flag(name)
+}
+
+// Always returns a rule that turns its flag on, or off if enabled is false,
+// when all its predicates match.
+func Always(enabled bool, predicates ...flags2.Predicate2) flags2.Rule2 {
+	percent := flags2.PercentOff
+	if enabled {
+		percent = flags2.PercentOn
+	}
+	return flags2.Rule2{HashBy: flags2.HashByRandom, Percent: percent, Predicates: predicates}
+}
+
+// Percent returns a rule that turns its flag on for the given fraction of
+// values of the hashBy property, when all its predicates match. If hashBy is
+// flags2.HashByRandom, the flag is on for that fraction of evaluations.
+func Percent(hashBy string, percent float64, predicates ...flags2.Predicate2) flags2.Rule2 {
+	return flags2.Rule2{HashBy: hashBy, Percent: percent, Predicates: predicates}
+}
+
+// In returns a predicate that matches if the attribute has one of the values.
+func In(attribute string, values ...string) flags2.Predicate2 {
+	return flags2.Predicate2{Attribute: attribute, Operation: flags2.OpIn, Values: valueSet(values)}
+}
+
+// NotIn returns a predicate that matches unless the attribute has one of the
+// values.
+func NotIn(attribute string, values ...string) flags2.Predicate2 {
+	return flags2.Predicate2{Attribute: attribute, Operation: flags2.OpNotIn, Values: valueSet(values)}
+}
+
+// IsNil returns a predicate that matches if the attribute is missing.
+func IsNil(attribute string) flags2.Predicate2 {
+	return flags2.Predicate2{Attribute: attribute, Operation: flags2.OpIsNil}
+}
+
+// NotNil returns a predicate that matches if the attribute is present.
+func NotNil(attribute string) flags2.Predicate2 {
+	return flags2.Predicate2{Attribute: attribute, Operation: flags2.OptNotNil}
+}
+
+func valueSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
@@ -0,0 +1,284 @@
+// Package goforittest provides an in-memory goforit for tests.
+//
+// A Fake evaluates flags exactly like goforit does, but its flags are set by
+// the test rather than loaded from a backend, and it records each evaluation
+// so that tests can assert on them:
+//
+//	f := goforittest.New(t, []*flags2.Flag2{goforittest.On("go.checkout")})
+//	f.Override(t, "go.new_api", true)
+//	run(f)
+//	f.AssertEvaluated(t, "go.checkout", map[string]string{"merchant": "m1"})
+package goforittest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/flags2"
+)
+
+// Evaluated is an evaluation recorded by a Fake.
+type Evaluated struct {
+	goforit.Evaluation
+	// Properties are the properties passed to the evaluation, merged with
+	// those attached to its context with goforit.WithProperties. They don't
+	// include default tags.
+	Properties map[string]string
+}
+
+// engine is everything the Goforit returned by goforit.New implements.
+type engine interface {
+	goforit.Goforit
+	goforit.Evaluator
+	goforit.StatusReporter
+	goforit.Subscriber
+	goforit.Inspector
+	goforit.Overrider
+	goforit.CountReporter
+}
+
+// Fake is a goforit.Goforit whose flags are held in memory. It also implements
+// the other interfaces the Goforit returned by goforit.New does. It is safe
+// for concurrent use.
+type Fake struct {
+	engine
+
+	backend *memoryBackend
+
+	mu          sync.Mutex
+	evaluations []Evaluated
+}
+
+// New returns a Fake with the given flags, which is closed when the test
+// finishes. Any options are passed on to goforit.New.
+func New(t testing.TB, flags []*flags2.Flag2, opts ...goforit.Option) *Fake {
+	f := &Fake{backend: &memoryBackend{flags: make(map[string]*flags2.Flag2)}}
+	f.backend.set(flags)
+
+	opts = append([]goforit.Option{
+		goforit.Statsd(NoopStats{}),
+		goforit.Logger(t.Logf),
+		goforit.EvaluationHooks(f.record),
+	}, opts...)
+	f.engine = goforit.New(0, f.backend, opts...).(engine)
+	t.Cleanup(func() { _ = f.Close() })
+	return f
+}
+
+// Set adds flags to the Fake, replacing any with the same names.
+func (f *Fake) Set(flags ...*flags2.Flag2) {
+	f.backend.set(flags)
+	f.RefreshFlags(f.backend)
+}
+
+// Remove removes the flags with the given names from the Fake, so that they
+// evaluate as unknown flags.
+func (f *Fake) Remove(names ...string) {
+	f.backend.remove(names)
+	f.RefreshFlags(f.backend)
+}
+
+// Override forces the flag with the given name to enabled until the test
+// finishes, when any override it replaced is restored. It is a runtime
+// override, so it applies to every evaluation by the Fake; use
+// goforit.Override for overrides scoped to a context.
+func (f *Fake) Override(t testing.TB, name string, enabled bool) {
+	previous, hadPrevious := f.runtimeOverride(name)
+	f.SetOverride(name, enabled, 0)
+	t.Cleanup(func() {
+		if !hadPrevious {
+			f.ClearOverride(name)
+			return
+		}
+		if previous.Expires.IsZero() {
+			f.SetOverride(name, previous.Enabled, 0)
+		} else if ttl := time.Until(previous.Expires); ttl > 0 {
+			f.SetOverride(name, previous.Enabled, ttl)
+		} else {
+			f.ClearOverride(name)
+		}
+	})
+}
+
+func (f *Fake) runtimeOverride(name string) (goforit.RuntimeOverride, bool) {
+	for _, o := range f.RuntimeOverrides() {
+		if o.Flag == name {
+			return o, true
+		}
+	}
+	return goforit.RuntimeOverride{}, false
+}
+
+// ForcePercentages makes every rule with a partial percentage behave as if
+// its percentage were PercentOn, or PercentOff if enabled is false, until the
+// test finishes, when any previous ForcePercentages is restored. Rules still
+// only apply if their predicates match, but no longer need the property they
+// hash by to be present.
+func (f *Fake) ForcePercentages(t testing.TB, enabled bool) {
+	previous := f.backend.force(&enabled)
+	f.RefreshFlags(f.backend)
+	t.Cleanup(func() {
+		f.backend.force(previous)
+		f.RefreshFlags(f.backend)
+	})
+}
+
+func (f *Fake) record(_ context.Context, properties map[string]string, evaluation goforit.Evaluation) {
+	// properties may belong to the caller, so it is copied.
+	props := make(map[string]string, len(properties))
+	for k, v := range properties {
+		props[k] = v
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.evaluations = append(f.evaluations, Evaluated{Evaluation: evaluation, Properties: props})
+}
+
+// Evaluations returns the evaluations of the flag with the given name, in
+// order, or every evaluation if name is empty.
+func (f *Fake) Evaluations(name string) []Evaluated {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var evaluations []Evaluated
+	for _, e := range f.evaluations {
+		if name == "" || e.Flag == name {
+			evaluations = append(evaluations, e)
+		}
+	}
+	return evaluations
+}
+
+// ResetEvaluations forgets the evaluations recorded so far.
+func (f *Fake) ResetEvaluations() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.evaluations = nil
+}
+
+// AssertEvaluated reports an error unless the flag with the given name was
+// evaluated with properties that include props. It returns whether it was.
+func (f *Fake) AssertEvaluated(t testing.TB, name string, props map[string]string) bool {
+	t.Helper()
+
+	evaluations := f.Evaluations(name)
+	for _, e := range evaluations {
+		if includes(e.Properties, props) {
+			return true
+		}
+	}
+
+	if len(evaluations) == 0 {
+		t.Errorf("flag %s was not evaluated", name)
+		return false
+	}
+	seen := make([]string, 0, len(evaluations))
+	for _, e := range evaluations {
+		seen = append(seen, fmt.Sprint(e.Properties))
+	}
+	t.Errorf("flag %s was not evaluated with properties %v, only with:\n\t%v", name, props, seen)
+	return false
+}
+
+// AssertNotEvaluated reports an error if the flag with the given name was
+// evaluated. It returns whether it wasn't.
+func (f *Fake) AssertNotEvaluated(t testing.TB, name string) bool {
+	t.Helper()
+
+	if evaluations := f.Evaluations(name); len(evaluations) > 0 {
+		t.Errorf("flag %s was evaluated %d times", name, len(evaluations))
+		return false
+	}
+	return true
+}
+
+func includes(props, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := props[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// memoryBackend serves flags held in memory.
+type memoryBackend struct {
+	mu     sync.Mutex
+	flags  map[string]*flags2.Flag2
+	forced *bool
+}
+
+func (b *memoryBackend) set(flags []*flags2.Flag2) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, flag := range flags {
+		b.flags[flag.Name] = flag
+	}
+}
+
+func (b *memoryBackend) remove(names []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range names {
+		delete(b.flags, name)
+	}
+}
+
+// force sets whether partial percentages are forced on or off, or not forced
+// if enabled is nil. It returns the previous setting.
+func (b *memoryBackend) force(enabled *bool) (previous *bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	previous, b.forced = b.forced, enabled
+	return previous
+}
+
+func (b *memoryBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	flags := make([]*flags2.Flag2, 0, len(b.flags))
+	for _, flag := range b.flags {
+		if b.forced != nil {
+			flag = forcePercentages(flag, *b.forced)
+		}
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, time.Now(), nil
+}
+
+// forcePercentages returns a copy of flag whose partial percentages are
+// replaced with PercentOn or PercentOff.
+func forcePercentages(flag *flags2.Flag2, enabled bool) *flags2.Flag2 {
+	percent := flags2.PercentOff
+	if enabled {
+		percent = flags2.PercentOn
+	}
+
+	forced := *flag
+	forced.Rules = make([]flags2.Rule2, len(flag.Rules))
+	for i, rule := range flag.Rules {
+		if rule.Percent > flags2.PercentOff && rule.Percent < flags2.PercentOn {
+			rule.Percent = percent
+		}
+		forced.Rules[i] = rule
+	}
+	return &forced
+}
+
+// NoopStats is a goforit.MetricsClient that discards every metric, for tests
+// that need a goforit created by goforit.New rather than a Fake.
+type NoopStats struct{}
+
+func (NoopStats) Histogram(string, float64, []string, float64) error          { return nil }
+func (NoopStats) TimeInMilliseconds(string, float64, []string, float64) error { return nil }
+func (NoopStats) Gauge(string, float64, []string, float64) error              { return nil }
+func (NoopStats) Count(string, int64, []string, float64) error                { return nil }
+func (NoopStats) Close() error                                                { return nil }
@@ -0,0 +1,162 @@
+package goforittest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/flags2"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+
+	f := New(t, []*flags2.Flag2{
+		On("go.on"),
+		Off("go.off"),
+		Flag("go.merchants", Always(true, In("merchant", "m1", "m2")), Always(false)),
+	})
+	ctx := context.Background()
+
+	assert.True(t, f.Ready())
+	assert.True(t, f.Enabled(ctx, "go.on", nil))
+	assert.False(t, f.Enabled(ctx, "go.off", nil))
+	assert.True(t, f.Enabled(ctx, "go.merchants", map[string]string{"merchant": "m2"}))
+	assert.False(t, f.Enabled(ctx, "go.merchants", map[string]string{"merchant": "m3"}))
+
+	f.Set(Off("go.on"), On("go.new"))
+	assert.False(t, f.Enabled(ctx, "go.on", nil))
+	assert.True(t, f.Enabled(ctx, "go.new", nil))
+
+	f.Remove("go.new")
+	assert.Equal(t, goforit.ReasonUndefined, f.Evaluate(ctx, "go.new", nil).Reason)
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	f := New(t, Load(t, filepath.Join("..", "testdata", "flags2_example.json")))
+	assert.Equal(t, 5, f.Status().FlagCount)
+	assert.True(t, f.Enabled(context.Background(), "go.moon.mercury", nil))
+}
+
+func TestOverride(t *testing.T) {
+	t.Parallel()
+
+	f := New(t, []*flags2.Flag2{Off("go.off")})
+	t.Run("overridden", func(t *testing.T) {
+		f.Override(t, "go.off", true)
+		assert.True(t, f.Enabled(context.Background(), "go.off", nil))
+
+		// Nested overrides restore the one they replaced.
+		t.Run("nested", func(t *testing.T) {
+			f.Override(t, "go.off", false)
+			assert.False(t, f.Enabled(context.Background(), "go.off", nil))
+		})
+		assert.True(t, f.Enabled(context.Background(), "go.off", nil))
+	})
+	assert.False(t, f.Enabled(context.Background(), "go.off", nil))
+	assert.Empty(t, f.RuntimeOverrides())
+
+	// So do overrides replacing ones set with SetOverride, keeping their expiry.
+	f.SetOverride("go.off", true, time.Hour)
+	t.Run("replaced", func(t *testing.T) {
+		f.Override(t, "go.off", false)
+		assert.False(t, f.Enabled(context.Background(), "go.off", nil))
+	})
+	overrides := f.RuntimeOverrides()
+	if assert.Len(t, overrides, 1) {
+		assert.True(t, overrides[0].Enabled)
+		assert.False(t, overrides[0].Expires.IsZero())
+	}
+}
+
+func TestForcePercentages(t *testing.T) {
+	t.Parallel()
+
+	f := New(t, []*flags2.Flag2{
+		Flag("go.ramp", Percent("user", 0.5, NotNil("user"))),
+		Flag("go.random", Percent(flags2.HashByRandom, 0.01)),
+	})
+
+	enabled := func(name string) (count int) {
+		for i := 0; i < 100; i++ {
+			if f.Enabled(context.Background(), name, map[string]string{"user": fmt.Sprint(i)}) {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("on", func(t *testing.T) {
+		f.ForcePercentages(t, true)
+		assert.Equal(t, 100, enabled("go.ramp"))
+		assert.Equal(t, 100, enabled("go.random"))
+		// Predicates still apply.
+		assert.False(t, f.Enabled(context.Background(), "go.ramp", nil))
+	})
+	t.Run("off", func(t *testing.T) {
+		f.ForcePercentages(t, false)
+		assert.Equal(t, 0, enabled("go.ramp"))
+		assert.Equal(t, 0, enabled("go.random"))
+
+		// Nested calls restore the setting they replaced.
+		t.Run("on", func(t *testing.T) {
+			f.ForcePercentages(t, true)
+			assert.Equal(t, 100, enabled("go.ramp"))
+		})
+		assert.Equal(t, 0, enabled("go.ramp"))
+	})
+
+	// The flag is back to its real definition.
+	n := enabled("go.ramp")
+	assert.True(t, n > 0 && n < 100, "go.ramp was on %d times", n)
+}
+
+func TestAssertEvaluated(t *testing.T) {
+	t.Parallel()
+
+	f := New(t, []*flags2.Flag2{On("go.on")})
+	ctx := goforit.WithProperties(context.Background(), map[string]string{"merchant": "m1", "user": "u1"})
+	f.Enabled(ctx, "go.on", map[string]string{"user": "u2"})
+	f.Enabled(context.Background(), "go.missing", nil)
+
+	assert.True(t, f.AssertEvaluated(t, "go.on", map[string]string{"merchant": "m1", "user": "u2"}))
+	assert.True(t, f.AssertNotEvaluated(t, "go.other"))
+	assert.Len(t, f.Evaluations(""), 2)
+
+	evaluations := f.Evaluations("go.on")
+	if assert.Len(t, evaluations, 1) {
+		assert.True(t, evaluations[0].Enabled)
+		assert.Equal(t, goforit.ReasonStatic, evaluations[0].Reason)
+	}
+
+	// Failures are reported to the test.
+	mock := &mockT{TB: t}
+	assert.False(t, f.AssertEvaluated(mock, "go.on", map[string]string{"user": "u1"}))
+	assert.False(t, f.AssertEvaluated(mock, "go.other", nil))
+	assert.False(t, f.AssertNotEvaluated(mock, "go.missing"))
+	assert.Equal(t, []string{
+		"flag go.on was not evaluated with properties map[user:u1], only with:\n\t[map[merchant:m1 user:u2]]",
+		"flag go.other was not evaluated",
+		"flag go.missing was evaluated 1 times",
+	}, mock.errors)
+
+	f.ResetEvaluations()
+	assert.Empty(t, f.Evaluations(""))
+}
+
+// mockT records errors instead of failing the test.
+type mockT struct {
+	testing.TB
+	errors []string
+}
+
+func (m *mockT) Errorf(format string, args ...interface{}) {
+	m.errors = append(m.errors, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,162 @@
+// Package middleware provides net/http middleware that forces goforit flags
+// for a single request, for QA and staging environments.
+//
+// A request sets flags with a header, which are applied to the request's
+// context with goforit.Override:
+//
+//	X-Goforit-Override: new_checkout=on,old_api=off
+//
+// Only flags in an allowlist can be overridden, and an authorization hook can
+// decide which requests may override flags at all, so that the middleware is
+// safe to leave enabled outside of production.
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/stripe/goforit"
+)
+
+// DefaultHeader is the header overrides are read from by default.
+const DefaultHeader = "X-Goforit-Override"
+
+// Option configures the middleware.
+type Option func(m *middleware)
+
+// Header sets the header overrides are read from. The default is
+// DefaultHeader.
+func Header(name string) Option {
+	return func(m *middleware) {
+		m.header = name
+	}
+}
+
+// Allow adds flags to the allowlist of flags that can be overridden. If a
+// name ends with "*", every flag whose name starts with the rest of it can be
+// overridden. By default no flags can be overridden.
+func Allow(flags ...string) Option {
+	return func(m *middleware) {
+		m.allowlist = append(m.allowlist, flags...)
+	}
+}
+
+// Authorize sets a hook that decides whether a request may override flags.
+// It is only called for requests with the override header, and if it returns
+// an error the request is refused with a 403. By default every request is
+// authorized.
+func Authorize(fn func(r *http.Request) error) Option {
+	return func(m *middleware) {
+		m.authorize = fn
+	}
+}
+
+type middleware struct {
+	next      http.Handler
+	header    string
+	allowlist Allowlist
+	authorize func(r *http.Request) error
+}
+
+// Overrides returns a handler that applies the overrides in each request's
+// header to its context, then calls next. Requests with malformed overrides,
+// or overrides of flags that aren't allowed, are refused with a 400.
+func Overrides(next http.Handler, opts ...Option) http.Handler {
+	m := &middleware{next: next, header: DefaultHeader}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	values := r.Header.Values(m.header)
+	if len(values) == 0 {
+		m.next.ServeHTTP(w, r)
+		return
+	}
+
+	if m.authorize != nil {
+		if err := m.authorize(r); err != nil {
+			http.Error(w, fmt.Sprintf("not allowed to override flags: %s", err), http.StatusForbidden)
+			return
+		}
+	}
+
+	overrides, err := Parse(strings.Join(values, ","))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	for _, o := range overrides {
+		if !m.allowlist.Allows(o.Flag) {
+			http.Error(w, fmt.Sprintf("flag %s can't be overridden", o.Flag), http.StatusBadRequest)
+			return
+		}
+		ctx = goforit.Override(ctx, o.Flag, o.Enabled)
+	}
+	m.next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Allowlist is a list of flags that can be overridden. If a name ends with
+// "*", every flag whose name starts with the rest of it is allowed.
+type Allowlist []string
+
+// Allows returns whether the flag is in the allowlist.
+func (a Allowlist) Allows(flag string) bool {
+	for _, pattern := range a {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(flag, prefix) {
+				return true
+			}
+		} else if flag == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Override is a flag value parsed from a header.
+type Override struct {
+	Flag    string
+	Enabled bool
+}
+
+// Parse parses a comma separated list of overrides, like "a=on,b=off". Values
+// can be on or off, true or false, or 1 or 0.
+func Parse(header string) ([]Override, error) {
+	var overrides []Override
+	for _, entry := range strings.Split(header, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		flag, value, ok := strings.Cut(entry, "=")
+		flag = strings.TrimSpace(flag)
+		if !ok || flag == "" {
+			return nil, fmt.Errorf("invalid override %q, expected flag=on or flag=off", entry)
+		}
+		enabled, err := parseValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid override %q: %w", entry, err)
+		}
+		overrides = append(overrides, Override{Flag: flag, Enabled: enabled})
+	}
+	return overrides, nil
+}
+
+var errInvalidValue = errors.New("value must be on or off")
+
+func parseValue(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	default:
+		return false, errInvalidValue
+	}
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/goforittest"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	overrides, err := Parse(" new_checkout=on, old_api = off,,a=TRUE,b=0")
+	assert.NoError(t, err)
+	assert.Equal(t, []Override{
+		{Flag: "new_checkout", Enabled: true},
+		{Flag: "old_api", Enabled: false},
+		{Flag: "a", Enabled: true},
+		{Flag: "b", Enabled: false},
+	}, overrides)
+
+	for _, header := range []string{"a", "=on", "a=maybe", "a=on,b"} {
+		_, err := Parse(header)
+		assert.Error(t, err, header)
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	t.Parallel()
+
+	allowlist := Allowlist{"go.a", "go.b*"}
+	assert.True(t, allowlist.Allows("go.a"))
+	assert.True(t, allowlist.Allows("go.b"))
+	assert.True(t, allowlist.Allows("go.b.c"))
+	assert.False(t, allowlist.Allows("go.a.b"))
+	assert.False(t, allowlist.Allows("go.c"))
+	assert.False(t, Allowlist(nil).Allows("go.a"))
+}
+
+func TestOverrides(t *testing.T) {
+	t.Parallel()
+
+	g := goforittest.New(t, goforittest.Load(t, filepath.Join("..", "testdata", "flags2_example.json")))
+
+	var evaluations goforit.Evaluations
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		evaluations = g.EvaluateAll(r.Context(), nil, goforit.PrefixFilter("go."))
+	})
+	h := Overrides(next,
+		Allow("go.moon.mercury", "go.stars.*"),
+		Authorize(func(r *http.Request) error {
+			if r.Header.Get("X-QA") == "" {
+				return errors.New("not a QA request")
+			}
+			return nil
+		}),
+	)
+
+	serve := func(header string, qa bool) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set(DefaultHeader, header)
+		}
+		if qa {
+			req.Header.Set("X-QA", "1")
+		}
+		rec := httptest.NewRecorder()
+		evaluations = nil
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("", false))
+	assert.True(t, evaluations["go.moon.mercury"].Enabled)
+
+	assert.Equal(t, http.StatusOK, serve("go.moon.mercury=off,go.stars.money=on,go.stars.new=on", true))
+	assert.False(t, evaluations["go.moon.mercury"].Enabled)
+	assert.Equal(t, goforit.ReasonOverride, evaluations["go.stars.money"].Reason)
+	assert.True(t, evaluations["go.stars.new"].Enabled)
+
+	assert.Equal(t, http.StatusForbidden, serve("go.moon.mercury=off", false))
+	assert.Equal(t, http.StatusBadRequest, serve("go.sun.money=on", true))
+	assert.Equal(t, http.StatusBadRequest, serve("go.moon.mercury", true))
+	assert.Nil(t, evaluations)
+}
+
+func TestNothingAllowed(t *testing.T) {
+	t.Parallel()
+
+	h := Overrides(http.NotFoundHandler(), Header("X-Flags"))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Flags", "go.moon.mercury=on")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,24 @@
+module github.com/stripe/goforit/openfeature
+
+go 1.19
+
+require (
+	github.com/open-feature/go-sdk v1.8.0
+	github.com/stretchr/testify v1.8.4
+	// Bumped to the root release with the APIs used here once it is tagged;
+	// see Releasing in README.md. Until then, the replace below is used.
+	github.com/stripe/goforit v0.0.0
+)
+
+require (
+	github.com/DataDog/datadog-go v4.8.3+incompatible // indirect
+	github.com/Microsoft/go-winio v0.5.2 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.2.4 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/exp v0.0.0-20230811145659-89c5cff77bcb // indirect
+	golang.org/x/sys v0.1.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/stripe/goforit => ../
@@ -0,0 +1,318 @@
+// Package openfeature provides an OpenFeature provider backed by goforit, so
+// that code written against the OpenFeature Go SDK evaluates flags with
+// goforit's rules and bucketing.
+//
+//	provider := openfeature.NewProvider(g, openfeature.TargetingKeyProperty("user"))
+//	defer provider.Shutdown()
+//	err := of.SetProvider(provider)
+//
+// goforit flags are booleans, so only boolean evaluation succeeds. Other
+// types resolve to their default value with a TYPE_MISMATCH error.
+package openfeature
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	of "github.com/open-feature/go-sdk/pkg/openfeature"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/flags2"
+)
+
+// ProviderName is the name in the provider's metadata.
+const ProviderName = "goforit"
+
+// OverrideReason is the reason given when a flag's value comes from a
+// goforit context or runtime override.
+const OverrideReason of.Reason = "OVERRIDE"
+
+// DefaultTargetingKeyProperty is the goforit property the targeting key is
+// mapped to by default.
+const DefaultTargetingKeyProperty = "token"
+
+// eventBuffer is the number of events buffered for the SDK. If the SDK falls
+// further behind, events are dropped rather than delaying goforit.
+const eventBuffer = 64
+
+// Option configures a provider created by NewProvider.
+type Option func(p *Provider)
+
+// TargetingKeyProperty sets the goforit property that the OpenFeature
+// targeting key is mapped to. It should be the property flags hash by, such
+// as "user" for flags with "hash_by": "user". The default is
+// DefaultTargetingKeyProperty.
+func TargetingKeyProperty(name string) Option {
+	return func(p *Provider) {
+		p.targetingKeyProperty = name
+	}
+}
+
+// Goforit is the part of goforit's API the provider uses. The Goforit returned
+// by goforit.New implements it.
+type Goforit interface {
+	goforit.Evaluator
+	goforit.StatusReporter
+	goforit.Subscriber
+	goforit.Inspector
+}
+
+// Provider is an OpenFeature provider that evaluates flags with goforit. It
+// implements of.FeatureProvider, of.StateHandler and of.EventHandler.
+type Provider struct {
+	g                    Goforit
+	targetingKeyProperty string
+
+	events      chan of.Event
+	ctx         context.Context
+	cancel      func()
+	unsubscribe []func()
+	shutdown    sync.Once
+
+	// state is the last state an event was sent for, only used by the
+	// notifier goroutine.
+	state of.State
+}
+
+// NewProvider returns a provider that evaluates flags with g. Shutting the
+// provider down doesn't close g.
+func NewProvider(g Goforit, opts ...Option) *Provider {
+	p := &Provider{
+		g:                    g,
+		targetingKeyProperty: DefaultTargetingKeyProperty,
+		events:               make(chan of.Event, eventBuffer),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.state = p.Status()
+	p.unsubscribe = []func(){
+		g.SubscribeBatch("*", p.changed),
+		g.SubscribeStatus(p.statusChanged),
+	}
+	return p
+}
+
+func (p *Provider) Metadata() of.Metadata {
+	return of.Metadata{Name: ProviderName}
+}
+
+func (p *Provider) Hooks() []of.Hook {
+	return nil
+}
+
+// Init waits for goforit's backend to refresh successfully. It returns an
+// error if the provider is shut down first.
+func (p *Provider) Init(_ of.EvaluationContext) error {
+	return p.g.WaitForReady(p.ctx)
+}
+
+// Shutdown stops sending events.
+func (p *Provider) Shutdown() {
+	p.shutdown.Do(func() {
+		for _, unsubscribe := range p.unsubscribe {
+			unsubscribe()
+		}
+		p.cancel()
+	})
+}
+
+// Status is NOT_READY until goforit's backend first refreshes successfully,
+// or ERROR if it has tried and failed. After that it is READY, or STALE while
+// refreshes are failing.
+func (p *Provider) Status() of.State {
+	return state(p.g.Status())
+}
+
+func state(status goforit.Status) of.State {
+	switch {
+	case !status.Ready && status.ConsecutiveFailures > 0:
+		return of.ErrorState
+	case !status.Ready:
+		return of.NotReadyState
+	case status.ConsecutiveFailures > 0:
+		return of.StaleState
+	default:
+		return of.ReadyState
+	}
+}
+
+// EventChannel delivers a PROVIDER_CONFIGURATION_CHANGED event for each
+// refresh that changes flags, listing all of them. It also delivers
+// PROVIDER_ERROR, PROVIDER_STALE and PROVIDER_READY events when Status
+// changes, except for the first PROVIDER_READY, which is covered by Init.
+// goforit.New tries to load flags before returning, so a provider for it
+// starts out in ERROR rather than sending PROVIDER_ERROR if that fails.
+func (p *Provider) EventChannel() <-chan of.Event {
+	return p.events
+}
+
+func (p *Provider) changed(changes []goforit.Change) {
+	names := make([]string, len(changes))
+	for i, change := range changes {
+		names[i] = change.Name
+	}
+	p.send(of.ProviderConfigChange, of.ProviderEventDetails{
+		Message:     fmt.Sprintf("flags changed: %s", strings.Join(names, ", ")),
+		FlagChanges: names,
+	})
+}
+
+func (p *Provider) statusChanged(status goforit.Status) {
+	prev := p.state
+	p.state = state(status)
+	if p.state == prev {
+		return
+	}
+
+	switch p.state {
+	case of.ErrorState:
+		p.send(of.ProviderError, of.ProviderEventDetails{
+			Message: fmt.Sprintf("flags failed to load: %s", status.LastError),
+		})
+	case of.StaleState:
+		p.send(of.ProviderStale, of.ProviderEventDetails{
+			Message: fmt.Sprintf("flags failed to refresh: %s", status.LastError),
+		})
+	case of.ReadyState:
+		if prev == of.StaleState {
+			p.send(of.ProviderReady, of.ProviderEventDetails{Message: "flags refreshed"})
+		}
+	}
+}
+
+func (p *Provider) send(eventType of.EventType, details of.ProviderEventDetails) {
+	event := of.Event{
+		ProviderName:         ProviderName,
+		EventType:            eventType,
+		ProviderEventDetails: details,
+	}
+	select {
+	case p.events <- event:
+	default:
+	}
+}
+
+func (p *Provider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, evalCtx of.FlattenedContext) of.BoolResolutionDetail {
+	e := p.g.Evaluate(ctx, flag, p.properties(evalCtx))
+
+	detail := of.BoolResolutionDetail{
+		Value: e.Enabled,
+		ProviderResolutionDetail: of.ProviderResolutionDetail{
+			Variant: strconv.FormatBool(e.Enabled),
+		},
+	}
+	switch e.Reason {
+	case goforit.ReasonUndefined:
+		return p.undefined(flag, defaultValue)
+	case goforit.ReasonError:
+		return of.BoolResolutionDetail{
+			Value: defaultValue,
+			ProviderResolutionDetail: of.ProviderResolutionDetail{
+				ResolutionError: of.NewGeneralResolutionError(e.Error),
+				Reason:          of.ErrorReason,
+			},
+		}
+	case goforit.ReasonOverride, goforit.ReasonRuntimeOverride:
+		detail.Reason = OverrideReason
+	case goforit.ReasonStatic:
+		detail.Reason = of.StaticReason
+	case goforit.ReasonNoRuleMatch:
+		detail.Reason = of.DefaultReason
+	case goforit.ReasonRuleMatch:
+		detail.Reason = p.ruleReason(flag, e.Rule)
+		detail.FlagMetadata = of.FlagMetadata{"rule": e.Rule}
+	default:
+		detail.Reason = of.UnknownReason
+	}
+	return detail
+}
+
+func (p *Provider) undefined(flag string, defaultValue bool) of.BoolResolutionDetail {
+	resolutionErr := of.NewFlagNotFoundResolutionError(fmt.Sprintf("flag %s is not defined", flag))
+	if !p.g.Ready() {
+		resolutionErr = of.NewProviderNotReadyResolutionError("flags have not been loaded")
+	}
+	return of.BoolResolutionDetail{
+		Value: defaultValue,
+		ProviderResolutionDetail: of.ProviderResolutionDetail{
+			ResolutionError: resolutionErr,
+			Reason:          of.ErrorReason,
+		},
+	}
+}
+
+// ruleReason is SPLIT if the rule that decided the flag enables it for a
+// fraction of evaluations, or TARGETING_MATCH otherwise.
+func (p *Provider) ruleReason(flag string, rule int) of.Reason {
+	if f, ok := p.g.Flag(flag); ok && rule >= 0 && rule < len(f.Rules) {
+		if percent := f.Rules[rule].Percent; percent > flags2.PercentOff && percent < flags2.PercentOn {
+			return of.SplitReason
+		}
+	}
+	return of.TargetingMatchReason
+}
+
+// properties converts an evaluation context to goforit properties. Scalar
+// values are formatted as strings, and other values are ignored. The
+// targeting key becomes the configured property, replacing any value the
+// context has for it.
+func (p *Provider) properties(evalCtx of.FlattenedContext) map[string]string {
+	if len(evalCtx) == 0 {
+		return nil
+	}
+	props := make(map[string]string, len(evalCtx))
+	for key, value := range evalCtx {
+		if s, ok := format(value); ok && key != of.TargetingKey {
+			props[key] = s
+		}
+	}
+	if s, ok := format(evalCtx[of.TargetingKey]); ok {
+		props[p.targetingKeyProperty] = s
+	}
+	return props
+}
+
+func format(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+func (p *Provider) StringEvaluation(_ context.Context, flag string, defaultValue string, _ of.FlattenedContext) of.StringResolutionDetail {
+	return of.StringResolutionDetail{Value: defaultValue, ProviderResolutionDetail: typeMismatch(flag, "string")}
+}
+
+func (p *Provider) FloatEvaluation(_ context.Context, flag string, defaultValue float64, _ of.FlattenedContext) of.FloatResolutionDetail {
+	return of.FloatResolutionDetail{Value: defaultValue, ProviderResolutionDetail: typeMismatch(flag, "float")}
+}
+
+func (p *Provider) IntEvaluation(_ context.Context, flag string, defaultValue int64, _ of.FlattenedContext) of.IntResolutionDetail {
+	return of.IntResolutionDetail{Value: defaultValue, ProviderResolutionDetail: typeMismatch(flag, "int")}
+}
+
+func (p *Provider) ObjectEvaluation(_ context.Context, flag string, defaultValue interface{}, _ of.FlattenedContext) of.InterfaceResolutionDetail {
+	return of.InterfaceResolutionDetail{Value: defaultValue, ProviderResolutionDetail: typeMismatch(flag, "object")}
+}
+
+func typeMismatch(flag, typ string) of.ProviderResolutionDetail {
+	return of.ProviderResolutionDetail{
+		ResolutionError: of.NewTypeMismatchResolutionError(fmt.Sprintf("flag %s is a boolean, not a %s", flag, typ)),
+		Reason:          of.ErrorReason,
+	}
+}
+
+var (
+	_ of.FeatureProvider = &Provider{}
+	_ of.StateHandler    = &Provider{}
+	_ of.EventHandler    = &Provider{}
+)
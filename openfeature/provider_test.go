@@ -0,0 +1,196 @@
+package openfeature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	of "github.com/open-feature/go-sdk/pkg/openfeature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/flags2"
+	"github.com/stripe/goforit/goforittest"
+)
+
+type testGoforit interface {
+	goforit.Goforit
+	Goforit
+}
+
+func testProvider(t *testing.T, backend goforit.Backend, opts ...Option) (testGoforit, *Provider) {
+	g := goforit.New(0, backend, goforit.Statsd(goforittest.NoopStats{}), goforit.Logger(t.Logf)).(testGoforit)
+	p := NewProvider(g, opts...)
+	t.Cleanup(func() {
+		p.Shutdown()
+		_ = g.Close()
+	})
+	return g, p
+}
+
+func exampleBackend() goforit.Backend {
+	return goforit.BackendFromJSONFile2(filepath.Join("..", "testdata", "flags2_example.json"))
+}
+
+type staticBackend struct {
+	flags []*flags2.Flag2
+	err   error
+}
+
+func (b *staticBackend) Refresh() ([]*flags2.Flag2, time.Time, error) {
+	return b.flags, time.Now(), b.err
+}
+
+func TestBooleanEvaluation(t *testing.T) {
+	t.Parallel()
+
+	_, p := testProvider(t, exampleBackend())
+	ctx := context.Background()
+
+	detail := p.BooleanEvaluation(ctx, "flag5", false, of.FlattenedContext{of.TargetingKey: "id_1", "country": "US"})
+	assert.True(t, detail.Value)
+	assert.Equal(t, of.TargetingMatchReason, detail.Reason)
+	assert.Equal(t, "true", detail.Variant)
+	assert.Equal(t, of.FlagMetadata{"rule": 0}, detail.FlagMetadata)
+	assert.NoError(t, detail.Error())
+
+	// The second rule of flag5 is a 50% ramp.
+	detail = p.BooleanEvaluation(ctx, "flag5", false, of.FlattenedContext{of.TargetingKey: "id_3"})
+	assert.Equal(t, of.SplitReason, detail.Reason)
+	assert.Equal(t, of.FlagMetadata{"rule": 1}, detail.FlagMetadata)
+
+	detail = p.BooleanEvaluation(ctx, "go.moon.mercury", false, nil)
+	assert.True(t, detail.Value)
+	assert.Equal(t, of.StaticReason, detail.Reason)
+
+	detail = p.BooleanEvaluation(goforit.Override(ctx, "off_flag", true), "off_flag", false, nil)
+	assert.True(t, detail.Value)
+	assert.Equal(t, OverrideReason, detail.Reason)
+
+	detail = p.BooleanEvaluation(ctx, "missing", true, nil)
+	assert.True(t, detail.Value)
+	assert.Equal(t, of.ErrorReason, detail.Reason)
+	assert.Equal(t, of.FlagNotFoundCode, detail.ResolutionDetail().ErrorCode)
+
+	sdetail := p.StringEvaluation(ctx, "flag5", "default", nil)
+	assert.Equal(t, "default", sdetail.Value)
+	assert.Equal(t, of.TypeMismatchCode, sdetail.ResolutionDetail().ErrorCode)
+}
+
+func TestTargetingKeyProperty(t *testing.T) {
+	t.Parallel()
+
+	flag := &flags2.Flag2{Name: "go.users", Rules: []flags2.Rule2{{
+		HashBy:     "user",
+		Percent:    flags2.PercentOn,
+		Predicates: []flags2.Predicate2{{Attribute: "user", Operation: flags2.OpIn, Values: map[string]bool{"u1": true}}},
+	}}}
+	_, p := testProvider(t, &staticBackend{flags: []*flags2.Flag2{flag}}, TargetingKeyProperty("user"))
+
+	assert.Equal(t, map[string]string{"user": "u1", "admin": "true", "age": "42"},
+		p.properties(of.FlattenedContext{of.TargetingKey: "u1", "user": "u2", "admin": true, "age": int64(42), "tags": []string{"a"}}))
+	assert.True(t, p.BooleanEvaluation(context.Background(), "go.users", false, of.FlattenedContext{of.TargetingKey: "u1"}).Value)
+	assert.False(t, p.BooleanEvaluation(context.Background(), "go.users", false, of.FlattenedContext{of.TargetingKey: "u2"}).Value)
+}
+
+func TestStatus(t *testing.T) {
+	t.Parallel()
+
+	backend := &staticBackend{err: errors.New("unavailable")}
+	g, p := testProvider(t, backend)
+
+	assert.Equal(t, of.ErrorState, p.Status())
+	detail := p.BooleanEvaluation(context.Background(), "go.flag", false, nil)
+	assert.Equal(t, of.ProviderNotReadyCode, detail.ResolutionDetail().ErrorCode)
+
+	backend.err = nil
+	backend.flags = []*flags2.Flag2{{Name: "go.flag"}}
+	g.RefreshFlags(backend)
+	assert.NoError(t, p.Init(of.EvaluationContext{}))
+	assert.Equal(t, of.ReadyState, p.Status())
+
+	backend.err = errors.New("unavailable")
+	g.RefreshFlags(backend)
+	assert.Equal(t, of.StaleState, p.Status())
+}
+
+func TestInitShutdown(t *testing.T) {
+	t.Parallel()
+
+	_, p := testProvider(t, &staticBackend{err: errors.New("unavailable")})
+
+	errs := make(chan error)
+	go func() { errs <- p.Init(of.EvaluationContext{}) }()
+	p.Shutdown()
+	assert.Error(t, <-errs)
+}
+
+func receiveEvent(t *testing.T, p *Provider) of.Event {
+	select {
+	case event := <-p.EventChannel():
+		assert.Equal(t, ProviderName, event.ProviderName)
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return of.Event{}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	backend := &staticBackend{err: errors.New("unavailable")}
+	g, p := testProvider(t, backend)
+
+	// A refresh changing more flags than the event buffer holds sends a
+	// single event listing all of them. Init covers the first load, so it
+	// doesn't send PROVIDER_READY.
+	var names []string
+	backend.flags = nil
+	for i := 0; i < 2*eventBuffer; i++ {
+		name := fmt.Sprintf("go.flag%03d", i)
+		names = append(names, name)
+		backend.flags = append(backend.flags, &flags2.Flag2{Name: name})
+	}
+	backend.err = nil
+	g.RefreshFlags(backend)
+	event := receiveEvent(t, p)
+	assert.Equal(t, of.ProviderConfigChange, event.EventType)
+	assert.Equal(t, names, event.FlagChanges)
+	assert.NoError(t, p.Init(of.EvaluationContext{}))
+
+	// Later failures make it stale, until a refresh succeeds.
+	backend.err = errors.New("unavailable")
+	g.RefreshFlags(backend)
+	g.RefreshFlags(backend)
+	assert.Equal(t, of.ProviderStale, receiveEvent(t, p).EventType)
+	backend.err = nil
+	g.RefreshFlags(backend)
+	assert.Equal(t, of.ProviderReady, receiveEvent(t, p).EventType)
+
+	select {
+	case event := <-p.EventChannel():
+		t.Fatalf("unexpected event %v", event)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestClient(t *testing.T) {
+	_, p := testProvider(t, exampleBackend())
+	require.NoError(t, of.SetProvider(p))
+	defer of.Shutdown()
+
+	client := of.NewClient("test")
+	details, err := client.BooleanValueDetails(context.Background(), "flag5", false,
+		of.NewEvaluationContext("id_1", map[string]interface{}{"country": "US"}))
+	require.NoError(t, err)
+	assert.True(t, details.Value)
+	assert.Equal(t, of.TargetingMatchReason, details.Reason)
+
+	_, err = client.StringValue(context.Background(), "flag5", "", of.EvaluationContext{})
+	assert.Error(t, err)
+}
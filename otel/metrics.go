@@ -0,0 +1,158 @@
+package otel
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/stripe/goforit"
+)
+
+// metricsClient records statsd-style metrics with OpenTelemetry instruments.
+// Instruments are created on first use, and named after the statsd metric.
+type metricsClient struct {
+	meter metric.Meter
+
+	mu         sync.Mutex
+	histograms map[string]metric.Float64Histogram
+	counters   map[string]metric.Int64Counter
+	gauges     map[string]*gauge
+}
+
+// NewMetricsClient returns a goforit.MetricsClient that records metrics with
+// instruments from meter. Histograms and timings become histograms, counts
+// become counters, and gauges become observable gauges reporting the last
+// value set for each set of attributes. Statsd tags like "key:value" become
+// attributes.
+func NewMetricsClient(meter metric.Meter) goforit.MetricsClient {
+	return &metricsClient{
+		meter:      meter,
+		histograms: make(map[string]metric.Float64Histogram),
+		counters:   make(map[string]metric.Int64Counter),
+		gauges:     make(map[string]*gauge),
+	}
+}
+
+func (c *metricsClient) Histogram(name string, value float64, tags []string, _ float64) error {
+	h, err := c.histogram(name)
+	if err != nil {
+		return err
+	}
+	h.Record(context.Background(), value, metric.WithAttributes(attributes(tags)...))
+	return nil
+}
+
+func (c *metricsClient) TimeInMilliseconds(name string, milli float64, tags []string, _ float64) error {
+	h, err := c.histogram(name, metric.WithUnit("ms"))
+	if err != nil {
+		return err
+	}
+	h.Record(context.Background(), milli, metric.WithAttributes(attributes(tags)...))
+	return nil
+}
+
+func (c *metricsClient) Gauge(name string, value float64, tags []string, _ float64) error {
+	g, err := c.gauge(name)
+	if err != nil {
+		return err
+	}
+	g.set(attribute.NewSet(attributes(tags)...), value)
+	return nil
+}
+
+func (c *metricsClient) Count(name string, value int64, tags []string, _ float64) error {
+	c.mu.Lock()
+	counter, ok := c.counters[name]
+	if !ok {
+		var err error
+		if counter, err = c.meter.Int64Counter(name); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		c.counters[name] = counter
+	}
+	c.mu.Unlock()
+
+	counter.Add(context.Background(), value, metric.WithAttributes(attributes(tags)...))
+	return nil
+}
+
+// Close does nothing, since the meter provider is owned by the caller.
+func (c *metricsClient) Close() error {
+	return nil
+}
+
+func (c *metricsClient) histogram(name string, opts ...metric.Float64HistogramOption) (metric.Float64Histogram, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if h, ok := c.histograms[name]; ok {
+		return h, nil
+	}
+	h, err := c.meter.Float64Histogram(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.histograms[name] = h
+	return h, nil
+}
+
+func (c *metricsClient) gauge(name string) (*gauge, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if g, ok := c.gauges[name]; ok {
+		return g, nil
+	}
+	g := &gauge{values: make(map[attribute.Distinct]gaugeValue)}
+	if _, err := c.meter.Float64ObservableGauge(name, metric.WithFloat64Callback(g.observe)); err != nil {
+		return nil, err
+	}
+	c.gauges[name] = g
+	return g, nil
+}
+
+// gauge holds the last value set for each set of attributes, which is
+// reported on every collection until it is set again, like a statsd gauge.
+type gauge struct {
+	mu     sync.Mutex
+	values map[attribute.Distinct]gaugeValue
+}
+
+type gaugeValue struct {
+	attrs attribute.Set
+	value float64
+}
+
+func (g *gauge) set(attrs attribute.Set, value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[attrs.Equivalent()] = gaugeValue{attrs: attrs, value: value}
+}
+
+func (g *gauge) observe(_ context.Context, o metric.Float64Observer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, v := range g.values {
+		o.Observe(v.value, metric.WithAttributeSet(v.attrs))
+	}
+	return nil
+}
+
+// attributes converts statsd tags to attributes.
+func attributes(tags []string) []attribute.KeyValue {
+	if len(tags) == 0 {
+		return nil
+	}
+	attrs := make([]attribute.KeyValue, len(tags))
+	for i, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		attrs[i] = attribute.String(key, value)
+	}
+	return attrs
+}
+
+var _ goforit.MetricsClient = &metricsClient{}
@@ -0,0 +1,29 @@
+// Package otel integrates goforit with OpenTelemetry. Flag evaluations are
+// recorded as events on the active span, and goforit's own metrics are
+// recorded with OpenTelemetry instruments instead of being sent to statsd.
+//
+// Both are wired in with goforit options:
+//
+//	g := goforit.New(interval, backend,
+//		otel.WithTracing(),
+//		otel.WithMetrics(meterProvider.Meter("goforit")),
+//	)
+package otel
+
+import (
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/stripe/goforit"
+)
+
+// WithTracing records each flag evaluation on the span in the context passed
+// to Enabled. See Hook.
+func WithTracing(opts ...TraceOption) goforit.Option {
+	return goforit.EvaluationHooks(Hook(opts...))
+}
+
+// WithMetrics records goforit's metrics with instruments from meter, in
+// place of statsd. See NewMetricsClient.
+func WithMetrics(meter metric.Meter) goforit.Option {
+	return goforit.Statsd(NewMetricsClient(meter))
+}
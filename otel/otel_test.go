@@ -0,0 +1,124 @@
+package otel
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/goforittest"
+)
+
+func testBackend() goforit.Backend {
+	return goforit.BackendFromJSONFile2(filepath.Join("..", "testdata", "flags2_example.json"))
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	g := goforittest.New(t, goforittest.Load(t, filepath.Join("..", "testdata", "flags2_example.json")), WithTracing(WithPropertyAttributes("token")))
+
+	ctx, span := tracer.Start(context.Background(), "request")
+	assert.True(t, g.Enabled(ctx, "flag5", map[string]string{"token": "id_1", "secret": "s"}))
+	assert.False(t, g.Enabled(ctx, "missing", nil))
+	span.End()
+
+	// Evaluations without a span, or without a context, are ignored.
+	assert.True(t, g.Enabled(context.Background(), "flag5", map[string]string{"token": "id_1"}))
+	assert.True(t, g.Enabled(nil, "flag5", map[string]string{"token": "id_1"}))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	events := spans[0].Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, EventName, events[0].Name)
+	assert.Equal(t, []attribute.KeyValue{
+		KeyAttribute.String("flag5"),
+		ProviderNameAttribute.String("goforit"),
+		VariantAttribute.String("true"),
+		ReasonAttribute.String("rule_match"),
+		attribute.String("feature_flag.property.token", "id_1"),
+	}, events[0].Attributes)
+	assert.Equal(t, []attribute.KeyValue{
+		KeyAttribute.String("missing"),
+		ProviderNameAttribute.String("goforit"),
+		VariantAttribute.String("false"),
+		ReasonAttribute.String("undefined"),
+	}, events[1].Attributes)
+}
+
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func TestMetricsClient(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	c := NewMetricsClient(meter)
+
+	require.NoError(t, c.Histogram("goforit.flags.last_refresh_s", 1.5, nil, 1))
+	require.NoError(t, c.Histogram("goforit.flags.last_refresh_s", 2.5, nil, 1))
+	require.NoError(t, c.TimeInMilliseconds("goforit.report-counts.duration", 3, nil, 1))
+	require.NoError(t, c.Count("goforit.flags.expired_evaluated", 1, []string{"flag:a"}, 1))
+	require.NoError(t, c.Count("goforit.flags.expired_evaluated", 2, []string{"flag:a"}, 1))
+	require.NoError(t, c.Gauge("goforit.refreshFlags.consecutive_errors", 3, nil, 1))
+	require.NoError(t, c.Gauge("goforit.refreshFlags.consecutive_errors", 0, nil, 1))
+	require.NoError(t, c.Close())
+
+	metrics := collect(t, reader)
+
+	hist := metrics["goforit.flags.last_refresh_s"].(metricdata.Histogram[float64])
+	require.Len(t, hist.DataPoints, 1)
+	assert.Equal(t, uint64(2), hist.DataPoints[0].Count)
+	assert.Equal(t, 4.0, hist.DataPoints[0].Sum)
+
+	timing := metrics["goforit.report-counts.duration"].(metricdata.Histogram[float64])
+	require.Len(t, timing.DataPoints, 1)
+	assert.Equal(t, 3.0, timing.DataPoints[0].Sum)
+
+	count := metrics["goforit.flags.expired_evaluated"].(metricdata.Sum[int64])
+	require.Len(t, count.DataPoints, 1)
+	assert.Equal(t, int64(3), count.DataPoints[0].Value)
+	flag, _ := count.DataPoints[0].Attributes.Value("flag")
+	assert.Equal(t, "a", flag.AsString())
+
+	gauge := metrics["goforit.refreshFlags.consecutive_errors"].(metricdata.Gauge[float64])
+	require.Len(t, gauge.DataPoints, 1)
+	assert.Equal(t, 0.0, gauge.DataPoints[0].Value)
+}
+
+func TestWithMetrics(t *testing.T) {
+	t.Parallel()
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+	g := goforit.New(0, testBackend(), WithMetrics(meter))
+	defer func() { _ = g.Close() }()
+
+	g.ReportCounts(func(name string, total, enabled uint64, isDeleted bool) {})
+
+	metrics := collect(t, reader)
+	assert.Contains(t, metrics, "goforit.report-counts.scanned")
+	assert.Contains(t, metrics, "goforit.report-counts.duration")
+}
@@ -0,0 +1,78 @@
+package otel
+
+import (
+	"context"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/stripe/goforit"
+)
+
+// Attributes of the events recorded for flag evaluations, following the
+// OpenTelemetry semantic conventions for feature flags.
+const (
+	EventName = "feature_flag"
+
+	KeyAttribute          = attribute.Key("feature_flag.key")
+	ProviderNameAttribute = attribute.Key("feature_flag.provider_name")
+	VariantAttribute      = attribute.Key("feature_flag.variant")
+	ReasonAttribute       = attribute.Key("feature_flag.evaluation.reason")
+	ErrorAttribute        = attribute.Key("feature_flag.evaluation.error.message")
+)
+
+const providerName = "goforit"
+
+// TraceOption configures the hook created by Hook.
+type TraceOption func(h *traceHook)
+
+// WithPropertyAttributes also records the given evaluation properties as
+// event attributes, named "feature_flag.property.<name>". Only list
+// properties that are safe to export.
+func WithPropertyAttributes(names ...string) TraceOption {
+	return func(h *traceHook) {
+		h.properties = append(h.properties, names...)
+	}
+}
+
+type traceHook struct {
+	properties []string
+}
+
+// Hook returns an evaluation hook that adds a "feature_flag" event to the
+// span in the evaluation's context, if it is recording. The variant is
+// "true" or "false".
+func Hook(opts ...TraceOption) goforit.EvaluationHook {
+	h := &traceHook{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h.record
+}
+
+func (h *traceHook) record(ctx context.Context, properties map[string]string, evaluation goforit.Evaluation) {
+	if ctx == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		KeyAttribute.String(evaluation.Flag),
+		ProviderNameAttribute.String(providerName),
+		VariantAttribute.String(strconv.FormatBool(evaluation.Enabled)),
+		ReasonAttribute.String(string(evaluation.Reason)),
+	}
+	if evaluation.Error != "" {
+		attrs = append(attrs, ErrorAttribute.String(evaluation.Error))
+	}
+	for _, name := range h.properties {
+		if value, ok := properties[name]; ok {
+			attrs = append(attrs, attribute.String("feature_flag.property."+name, value))
+		}
+	}
+	span.AddEvent(EventName, trace.WithAttributes(attrs...))
+}
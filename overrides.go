@@ -0,0 +1,133 @@
+package goforit
+
+import (
+	"sort"
+	"time"
+)
+
+// RuntimeOverride forces the value of a flag in the running process, for
+// example to turn a feature off while its flag definition is broken.
+type RuntimeOverride struct {
+	Flag    string
+	Enabled bool
+	// Expires is when the override stops applying, or the zero time if it
+	// doesn't expire.
+	Expires time.Time
+}
+
+func (o RuntimeOverride) expired(now time.Time) bool {
+	return !o.Expires.IsZero() && !now.Before(o.Expires)
+}
+
+// Overrider is implemented by the Goforit returned by New, to override flags
+// at runtime.
+type Overrider interface {
+	SetOverride(name string, enabled bool, ttl time.Duration)
+	ClearOverride(name string)
+	RuntimeOverrides() []RuntimeOverride
+}
+
+// OverrideAuditCallback registers a callback to execute each time a runtime
+// override is set or cleared, for example to write an audit log. It is called
+// before the change is made.
+func OverrideAuditCallback(cb func(override RuntimeOverride, cleared bool)) Option {
+	return optionFunc(func(g *goforit) {
+		g.overrideAuditCB = cb
+	})
+}
+
+type runtimeOverrides map[string]RuntimeOverride
+
+// runtimeOverride returns the unexpired runtime override for name, if any.
+func (g *goforit) runtimeOverride(name string) (RuntimeOverride, bool) {
+	ovs := g.runtimeOverrides.Load()
+	if ovs == nil {
+		return RuntimeOverride{}, false
+	}
+	o, ok := (*ovs)[name]
+	if !ok || o.expired(time.Now()) {
+		return RuntimeOverride{}, false
+	}
+	return o, true
+}
+
+// SetOverride forces the flag with the given name to enabled in this process,
+// whatever its definition says, until ttl has passed or it is cleared. If ttl
+// is zero, the override doesn't expire. Context overrides still take
+// precedence over runtime overrides.
+func (g *goforit) SetOverride(name string, enabled bool, ttl time.Duration) {
+	o := RuntimeOverride{Flag: name, Enabled: enabled}
+	if ttl > 0 {
+		o.Expires = time.Now().Add(ttl)
+	}
+	g.updateOverrides(o, false)
+}
+
+// ClearOverride removes the runtime override for the flag with the given
+// name, if there is one.
+func (g *goforit) ClearOverride(name string) {
+	if o, ok := g.runtimeOverride(name); ok {
+		g.updateOverrides(o, true)
+	}
+}
+
+func (g *goforit) updateOverrides(o RuntimeOverride, cleared bool) {
+	g.overridesMu.Lock()
+	defer g.overridesMu.Unlock()
+
+	if g.overrideAuditCB != nil {
+		g.overrideAuditCB(o, cleared)
+	}
+
+	// Copy on write, dropping expired overrides as we go.
+	now := time.Now()
+	ovs := make(runtimeOverrides)
+	if old := g.runtimeOverrides.Load(); old != nil {
+		for name, existing := range *old {
+			if !existing.expired(now) {
+				ovs[name] = existing
+			}
+		}
+	}
+	if cleared {
+		delete(ovs, o.Flag)
+	} else {
+		ovs[o.Flag] = o
+	}
+
+	if len(ovs) == 0 {
+		g.runtimeOverrides.Store(nil)
+	} else {
+		g.runtimeOverrides.Store(&ovs)
+	}
+
+	if timer, ok := g.overrideTimers[o.Flag]; ok {
+		timer.Stop()
+		delete(g.overrideTimers, o.Flag)
+	}
+	if !cleared && !o.Expires.IsZero() && !g.isClosed.Load() {
+		if g.overrideTimers == nil {
+			g.overrideTimers = make(map[string]*time.Timer)
+		}
+		g.overrideTimers[o.Flag] = time.AfterFunc(o.Expires.Sub(now), g.notifier.overridesChanged)
+	}
+	g.notifier.overridesChanged()
+}
+
+// RuntimeOverrides lists the runtime overrides that haven't expired, ordered
+// by flag name.
+func (g *goforit) RuntimeOverrides() []RuntimeOverride {
+	ovs := g.runtimeOverrides.Load()
+	if ovs == nil {
+		return nil
+	}
+	now := time.Now()
+	var list []RuntimeOverride
+	for _, o := range *ovs {
+		if !o.expired(now) {
+			list = append(list, o)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Flag < list[j].Flag })
+	return list
+}
@@ -0,0 +1,184 @@
+// Package prometheus exports goforit telemetry as Prometheus metrics, for
+// services that scrape Prometheus rather than send statsd metrics.
+//
+// Register a collector for each Goforit instance:
+//
+//	registry.MustRegister(prometheus.NewCollector(g))
+package prometheus
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/stripe/goforit"
+)
+
+// Option configures a collector created by NewCollector.
+type Option func(c *collector)
+
+// ConstLabels adds labels to every metric, for example to tell apart several
+// Goforit instances registered on the same registry.
+func ConstLabels(labels prom.Labels) Option {
+	return func(c *collector) {
+		c.constLabels = labels
+	}
+}
+
+// WithoutFlagCounts disables the per-flag evaluation counters. Use it if the
+// counts are already reported with ReportCounts, since both consume the same
+// counts.
+func WithoutFlagCounts() Option {
+	return func(c *collector) {
+		c.flagCounts = false
+	}
+}
+
+type flagKey struct {
+	flag  string
+	value string
+}
+
+type ruleKey struct {
+	flag string
+	rule int
+}
+
+// Goforit is the part of goforit's API the collector uses. The Goforit
+// returned by goforit.New implements it.
+type Goforit interface {
+	goforit.StatusReporter
+	goforit.CountReporter
+}
+
+type collector struct {
+	g           Goforit
+	constLabels prom.Labels
+	flagCounts  bool
+
+	ready               *prom.Desc
+	lastSuccess         *prom.Desc
+	refreshAge          *prom.Desc
+	refreshFailures     *prom.Desc
+	consecutiveFailures *prom.Desc
+	flags               *prom.Desc
+	evaluations         *prom.Desc
+	overrides           *prom.Desc
+	errors              *prom.Desc
+	ruleMatches         *prom.Desc
+
+	// mu protects the running totals below, since goforit resets its counts
+	// each time they are reported.
+	mu                sync.Mutex
+	evaluationTotals  map[flagKey]uint64
+	overrideTotals    map[string]uint64
+	errorTotals       map[string]uint64
+	ruleMatchesTotals map[ruleKey]uint64
+}
+
+// NewCollector returns a collector for the state of g, and for how its flags
+// were evaluated.
+//
+// The per-flag counters are read with ReportDetailedCounts, which resets
+// goforit's own counts, so they shouldn't also be reported with ReportCounts
+// unless WithoutFlagCounts is used. The override, error and rule match
+// counters are only reported if g was created with goforit.DetailedCounts.
+func NewCollector(g Goforit, opts ...Option) prom.Collector {
+	c := &collector{
+		g:                 g,
+		flagCounts:        true,
+		evaluationTotals:  make(map[flagKey]uint64),
+		overrideTotals:    make(map[string]uint64),
+		errorTotals:       make(map[string]uint64),
+		ruleMatchesTotals: make(map[ruleKey]uint64),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	desc := func(name, help string, labels ...string) *prom.Desc {
+		return prom.NewDesc(prom.BuildFQName("goforit", "", name), help, labels, c.constLabels)
+	}
+	c.ready = desc("ready", "Whether the backend has refreshed successfully.")
+	c.lastSuccess = desc("last_refresh_success_timestamp_seconds", "When the backend last refreshed successfully.")
+	c.refreshAge = desc("last_refresh_age_seconds", "Time since the backend last refreshed successfully.")
+	c.refreshFailures = desc("refresh_failures_total", "Refreshes that failed.")
+	c.consecutiveFailures = desc("refresh_consecutive_failures", "Refreshes that failed since the last successful one.")
+	c.flags = desc("flags", "Flags loaded.")
+	c.evaluations = desc("evaluations_total", "Evaluations decided by the flag, by result.", "flag", "value")
+	c.overrides = desc("evaluation_overrides_total", "Evaluations decided by a context or runtime override.", "flag")
+	c.errors = desc("evaluation_errors_total", "Evaluations that failed.", "flag")
+	c.ruleMatches = desc("rule_matches_total", "Evaluations decided by each rule.", "flag", "rule")
+	return c
+}
+
+func (c *collector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.ready
+	ch <- c.lastSuccess
+	ch <- c.refreshAge
+	ch <- c.refreshFailures
+	ch <- c.consecutiveFailures
+	ch <- c.flags
+	if c.flagCounts {
+		ch <- c.evaluations
+		ch <- c.overrides
+		ch <- c.errors
+		ch <- c.ruleMatches
+	}
+}
+
+func (c *collector) Collect(ch chan<- prom.Metric) {
+	status := c.g.Status()
+	ready := 0.0
+	if status.Ready {
+		ready = 1
+	}
+	ch <- prom.MustNewConstMetric(c.ready, prom.GaugeValue, ready)
+	if !status.LastSuccess.IsZero() {
+		ch <- prom.MustNewConstMetric(c.lastSuccess, prom.GaugeValue, float64(status.LastSuccess.UnixNano())/float64(time.Second))
+		ch <- prom.MustNewConstMetric(c.refreshAge, prom.GaugeValue, time.Since(status.LastSuccess).Seconds())
+	}
+	ch <- prom.MustNewConstMetric(c.refreshFailures, prom.CounterValue, float64(status.Failures))
+	ch <- prom.MustNewConstMetric(c.consecutiveFailures, prom.GaugeValue, float64(status.ConsecutiveFailures))
+	ch <- prom.MustNewConstMetric(c.flags, prom.GaugeValue, float64(status.FlagCount))
+
+	if c.flagCounts {
+		c.collectFlagCounts(ch)
+	}
+}
+
+func (c *collector) collectFlagCounts(ch chan<- prom.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.g.ReportDetailedCounts(func(counts goforit.FlagCounts) {
+		c.evaluationTotals[flagKey{counts.Name, "true"}] += counts.Enabled
+		c.evaluationTotals[flagKey{counts.Name, "false"}] += counts.Total - counts.Enabled
+		if counts.Overrides > 0 {
+			c.overrideTotals[counts.Name] += counts.Overrides
+		}
+		if counts.Errors > 0 {
+			c.errorTotals[counts.Name] += counts.Errors
+		}
+		for rule, matches := range counts.Rules {
+			if matches > 0 {
+				c.ruleMatchesTotals[ruleKey{counts.Name, rule}] += matches
+			}
+		}
+	})
+
+	for key, total := range c.evaluationTotals {
+		ch <- prom.MustNewConstMetric(c.evaluations, prom.CounterValue, float64(total), key.flag, key.value)
+	}
+	for flag, total := range c.overrideTotals {
+		ch <- prom.MustNewConstMetric(c.overrides, prom.CounterValue, float64(total), flag)
+	}
+	for flag, total := range c.errorTotals {
+		ch <- prom.MustNewConstMetric(c.errors, prom.CounterValue, float64(total), flag)
+	}
+	for key, total := range c.ruleMatchesTotals {
+		ch <- prom.MustNewConstMetric(c.ruleMatches, prom.CounterValue, float64(total), key.flag, strconv.Itoa(key.rule))
+	}
+}
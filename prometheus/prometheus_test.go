@@ -0,0 +1,103 @@
+package prometheus
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/stripe/goforit"
+	"github.com/stripe/goforit/goforittest"
+)
+
+type testGoforit interface {
+	goforit.Goforit
+	Goforit
+}
+
+func newTestGoforit(t *testing.T) testGoforit {
+	return goforittest.New(t, goforittest.Load(t, filepath.Join("..", "testdata", "flags2_example.json")), goforit.DetailedCounts(true))
+}
+
+func TestCollector(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGoforit(t)
+	registry := prom.NewPedanticRegistry()
+	require.NoError(t, registry.Register(NewCollector(g, ConstLabels(prom.Labels{"instance": "test"}))))
+
+	ctx := context.Background()
+	props := map[string]string{"token": "id_1"}
+	assert.True(t, g.Enabled(ctx, "flag5", props))
+	assert.True(t, g.Enabled(ctx, "flag5", props))
+	assert.False(t, g.Enabled(ctx, "off_flag", nil))
+	assert.False(t, g.Enabled(goforit.Override(ctx, "flag5", false), "flag5", props))
+
+	expected := `
+# HELP goforit_evaluation_overrides_total Evaluations decided by a context or runtime override.
+# TYPE goforit_evaluation_overrides_total counter
+goforit_evaluation_overrides_total{flag="flag5",instance="test"} 1
+# HELP goforit_evaluations_total Evaluations decided by the flag, by result.
+# TYPE goforit_evaluations_total counter
+goforit_evaluations_total{flag="flag5",instance="test",value="false"} 0
+goforit_evaluations_total{flag="flag5",instance="test",value="true"} 2
+goforit_evaluations_total{flag="off_flag",instance="test",value="false"} 1
+goforit_evaluations_total{flag="off_flag",instance="test",value="true"} 0
+# HELP goforit_flags Flags loaded.
+# TYPE goforit_flags gauge
+goforit_flags{instance="test"} 5
+# HELP goforit_ready Whether the backend has refreshed successfully.
+# TYPE goforit_ready gauge
+goforit_ready{instance="test"} 1
+# HELP goforit_refresh_failures_total Refreshes that failed.
+# TYPE goforit_refresh_failures_total counter
+goforit_refresh_failures_total{instance="test"} 0
+# HELP goforit_rule_matches_total Evaluations decided by each rule.
+# TYPE goforit_rule_matches_total counter
+goforit_rule_matches_total{flag="flag5",instance="test",rule="0"} 2
+`
+	names := []string{
+		"goforit_evaluation_overrides_total",
+		"goforit_evaluations_total",
+		"goforit_flags",
+		"goforit_ready",
+		"goforit_refresh_failures_total",
+		"goforit_rule_matches_total",
+	}
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), names...))
+
+	// Counts accumulate across scrapes.
+	assert.True(t, g.Enabled(ctx, "flag5", props))
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP goforit_rule_matches_total Evaluations decided by each rule.
+# TYPE goforit_rule_matches_total counter
+goforit_rule_matches_total{flag="flag5",instance="test",rule="0"} 3
+`), "goforit_rule_matches_total"))
+
+	assert.Equal(t, 1, testutil.CollectAndCount(NewCollector(g), "goforit_last_refresh_age_seconds"))
+}
+
+func TestWithoutFlagCounts(t *testing.T) {
+	t.Parallel()
+
+	g := newTestGoforit(t)
+	assert.True(t, g.Enabled(context.Background(), "go.moon.mercury", nil))
+
+	c := NewCollector(g, WithoutFlagCounts())
+	assert.Zero(t, testutil.CollectAndCount(c, "goforit_evaluations_total"))
+	problems, err := testutil.CollectAndLint(c)
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+
+	// The counts are left for ReportCounts.
+	reported := 0
+	g.ReportCounts(func(name string, total, enabled uint64, isDeleted bool) {
+		reported++
+	})
+	assert.Equal(t, 1, reported)
+}
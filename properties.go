@@ -0,0 +1,57 @@
+package goforit
+
+import (
+	"context"
+)
+
+type propertiesContextKeyType struct{}
+
+var propertiesContextKey = propertiesContextKeyType{}
+
+// WithProperties attaches evaluation properties to ctx, so that flags
+// evaluated with it don't need them passed explicitly. Properties added to a
+// context that already has some are merged with them, replacing any with the
+// same name.
+//
+// When a flag is evaluated, properties passed to Enabled take precedence over
+// properties in the context, which take precedence over default tags.
+func WithProperties(ctx context.Context, props map[string]string) context.Context {
+	merged := make(map[string]string, len(props))
+	for k, v := range Properties(ctx) {
+		merged[k] = v
+	}
+	for k, v := range props {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, propertiesContextKey, merged)
+}
+
+// Properties returns the properties attached to ctx with WithProperties, or
+// nil if there are none. The result must not be modified.
+func Properties(ctx context.Context) map[string]string {
+	if ctx == nil {
+		return nil
+	}
+	props, _ := ctx.Value(propertiesContextKey).(map[string]string)
+	return props
+}
+
+// withContextProperties merges the properties in ctx into properties, which
+// take precedence. It only allocates if both have properties.
+func withContextProperties(ctx context.Context, properties map[string]string) map[string]string {
+	ctxProps := Properties(ctx)
+	if len(ctxProps) == 0 {
+		return properties
+	}
+	if len(properties) == 0 {
+		return ctxProps
+	}
+	merged := make(map[string]string, len(ctxProps)+len(properties))
+	for k, v := range ctxProps {
+		merged[k] = v
+	}
+	for k, v := range properties {
+		merged[k] = v
+	}
+	return merged
+}
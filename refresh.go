@@ -0,0 +1,81 @@
+package goforit
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	consecutiveErrorsMetricName = "goforit.refreshFlags.consecutive_errors"
+	failureStreakMetricName     = "goforit.refreshFlags.failure_streak"
+)
+
+// RefreshJitter randomizes each refresh interval by up to the given fraction
+// of it, in either direction, so that a fleet of processes doesn't refresh in
+// lockstep. The fraction must be between 0 and 1.
+func RefreshJitter(fraction float64) Option {
+	return optionFunc(func(g *goforit) {
+		if fraction < 0 {
+			fraction = 0
+		} else if fraction > 1 {
+			fraction = 1
+		}
+		g.refreshJitter = fraction
+	})
+}
+
+// RefreshBackoff makes the refresh loop retry failed refreshes after initial,
+// rather than after the usual interval, doubling the delay for each further
+// consecutive failure up to max. As soon as a refresh succeeds again, the
+// usual interval resumes.
+func RefreshBackoff(initial, max time.Duration) Option {
+	return optionFunc(func(g *goforit) {
+		if max < initial {
+			max = initial
+		}
+		g.backoffInitial = initial
+		g.backoffMax = max
+	})
+}
+
+// nextRefreshDelay returns how long the refresh loop should wait before the
+// next refresh.
+func (g *goforit) nextRefreshDelay(interval time.Duration) time.Duration {
+	delay := interval
+
+	g.statusMu.Lock()
+	failures := g.status.consecutiveFailures
+	g.statusMu.Unlock()
+
+	if failures > 0 && g.backoffInitial > 0 {
+		delay = g.backoffInitial
+		for i := 1; i < failures && delay < g.backoffMax; i++ {
+			delay *= 2
+		}
+		if delay > g.backoffMax {
+			delay = g.backoffMax
+		}
+	}
+
+	if g.refreshJitter > 0 {
+		delay += time.Duration((2*g.rnd.Float64() - 1) * g.refreshJitter * float64(delay))
+	}
+	return delay
+}
+
+// refreshLoop refreshes from backend until ctx is done, waiting
+// nextRefreshDelay between refreshes.
+func (g *goforit) refreshLoop(ctx context.Context, interval time.Duration, backend Backend) {
+	timer := time.NewTimer(g.nextRefreshDelay(interval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			g.RefreshFlags(backend)
+			timer.Reset(g.nextRefreshDelay(interval))
+		}
+	}
+}
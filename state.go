@@ -0,0 +1,63 @@
+package goforit
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/stripe/goforit/clamp"
+	"github.com/stripe/goforit/flags2"
+)
+
+// FlagState describes a loaded flag, for debugging.
+type FlagState struct {
+	Flag  *flags2.Flag2
+	Clamp clamp.Clamp
+	// Expired is true if the flag is past its expiry time.
+	Expired bool
+	// Total and Enabled count the evaluations since counts were last
+	// reported, like ReportCounts. Reading them doesn't reset them.
+	Total   uint64
+	Enabled uint64
+}
+
+// Inspector is implemented by the Goforit returned by New, to describe the
+// loaded flags for tooling and debugging.
+type Inspector interface {
+	Flag(name string) (*flags2.Flag2, bool)
+	CleanupCandidates() []CleanupCandidate
+	FlagStates() []FlagState
+	DefaultTags() map[string]string
+	Explain(ctx context.Context, name string, properties map[string]string) Evaluation
+}
+
+// FlagStates describes every loaded flag, ordered by name.
+func (g *goforit) FlagStates() []FlagState {
+	now := time.Now()
+	flags := g.flags.load()
+	states := make([]FlagState, 0, len(flags))
+	for _, holder := range flags {
+		enabled := holder.enabledCount.Load()
+		states = append(states, FlagState{
+			Flag:    holder.flag,
+			Clamp:   holder.clamp,
+			Expired: holder.flag.Expired(now),
+			Total:   enabled + holder.disabledCount.Load(),
+			Enabled: enabled,
+		})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Flag.Name < states[j].Flag.Name
+	})
+	return states
+}
+
+// DefaultTags returns a copy of the tags added with AddDefaultTags.
+func (g *goforit) DefaultTags() map[string]string {
+	tags := g.defaultTags.Load()
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return copied
+}
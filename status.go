@@ -0,0 +1,114 @@
+package goforit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrClosed is returned by WaitForReady if Goforit is closed before the
+// backend refreshes successfully.
+var ErrClosed = errors.New("goforit: closed")
+
+// Status describes how well Goforit is keeping its flags up to date.
+type Status struct {
+	// Ready is true once the backend has refreshed successfully.
+	Ready bool
+	// LastSuccess is the time of the last successful refresh.
+	LastSuccess time.Time
+	// LastError is the error from the last failed refresh, if any.
+	LastError error
+	// ConsecutiveFailures counts the refreshes that failed since the last
+	// successful one.
+	ConsecutiveFailures int
+	// Failures counts every refresh that failed.
+	Failures uint64
+	// FlagCount is the number of flags loaded.
+	FlagCount int
+	// Version identifies the set of loaded flags. It changes whenever the
+	// flags do.
+	Version uint64
+}
+
+// refreshStatus is the part of Status updated by refreshes, protected by
+// goforit.statusMu.
+type refreshStatus struct {
+	lastSuccess         time.Time
+	lastError           error
+	consecutiveFailures int
+	failures            uint64
+}
+
+func (g *goforit) recordRefresh(err error) {
+	g.statusMu.Lock()
+	defer g.statusMu.Unlock()
+
+	stats := g.getStats()
+	if err != nil {
+		g.status.lastError = err
+		g.status.consecutiveFailures++
+		g.status.failures++
+		_ = stats.Gauge(consecutiveErrorsMetricName, float64(g.status.consecutiveFailures), nil, 1)
+		return
+	}
+
+	if g.status.consecutiveFailures > 0 {
+		_ = stats.Histogram(failureStreakMetricName, float64(g.status.consecutiveFailures), nil, 1)
+		_ = stats.Gauge(consecutiveErrorsMetricName, 0, nil, 1)
+	}
+	g.status.lastSuccess = time.Now()
+	g.status.consecutiveFailures = 0
+	if !g.refreshed.Swap(true) {
+		close(g.ready)
+	}
+}
+
+// StatusReporter is implemented by the Goforit returned by New, to report
+// whether flags have loaded.
+type StatusReporter interface {
+	Ready() bool
+	WaitForReady(ctx context.Context) error
+	Status() Status
+}
+
+// Ready returns true once the backend has refreshed successfully.
+func (g *goforit) Ready() bool {
+	return g.refreshed.Load()
+}
+
+// WaitForReady blocks until the backend has refreshed successfully. It
+// returns early with an error if ctx is done, or if Goforit is closed.
+func (g *goforit) WaitForReady(ctx context.Context) error {
+	select {
+	case <-g.ready:
+		return nil
+	default:
+	}
+
+	select {
+	case <-g.ready:
+		return nil
+	case <-g.ctx.Done():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the current status of the flags.
+func (g *goforit) Status() Status {
+	g.statusMu.Lock()
+	status := g.status
+	g.statusMu.Unlock()
+
+	set := g.flags.loadSet()
+	return Status{
+		Ready:               g.refreshed.Load(),
+		LastSuccess:         status.lastSuccess,
+		LastError:           status.lastError,
+		ConsecutiveFailures: status.consecutiveFailures,
+		Failures:            status.failures,
+		FlagCount:           len(set.flags),
+		Version:             set.version,
+	}
+}
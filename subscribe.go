@@ -0,0 +1,300 @@
+package goforit
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/stripe/goforit/flags2"
+)
+
+// ChangeFunc is called when a flag changes. When a flag is added, old is
+// nil, and when a flag is removed, new is nil. The flags must not be modified.
+type ChangeFunc func(old, new *flags2.Flag2)
+
+// ChangeCallback registers a callback to execute for every flag that changes.
+// Like subscriptions, it is called asynchronously after each refresh.
+func ChangeCallback(cb ChangeFunc) Option {
+	return optionFunc(func(g *goforit) {
+		g.notifier.subscribe("*", cb)
+	})
+}
+
+// Change is a change to a flag made by a refresh. When a flag is added, Old
+// is nil, and when a flag is removed, New is nil. The flags must not be
+// modified.
+type Change struct {
+	Name     string
+	Old, New *flags2.Flag2
+}
+
+// BatchFunc is called with the flags changed by a refresh, in name order.
+type BatchFunc func(changes []Change)
+
+// StatusFunc is called with the status after a refresh.
+type StatusFunc func(status Status)
+
+// subscription has either fn or batch set.
+type subscription struct {
+	name   string
+	prefix bool
+	fn     ChangeFunc
+	batch  BatchFunc
+}
+
+func (s *subscription) deliver(changes []flagChange) {
+	if s.fn != nil {
+		for _, change := range changes {
+			if s.matches(change.name) {
+				s.fn(change.old, change.new)
+			}
+		}
+		return
+	}
+
+	var batch []Change
+	for _, change := range changes {
+		if s.matches(change.name) {
+			batch = append(batch, Change{Name: change.name, Old: change.old, New: change.new})
+		}
+	}
+	if len(batch) > 0 {
+		s.batch(batch)
+	}
+}
+
+func (s *subscription) matches(name string) bool {
+	if s.prefix {
+		return strings.HasPrefix(name, s.name)
+	}
+	return name == s.name
+}
+
+// notification is what a refresh queues for delivery: the flags it changed,
+// and the status after it if anyone is subscribed to that.
+type notification struct {
+	changes []flagChange
+	status  *Status
+}
+
+// merge adds a later notification to n. Each flag that changed in either
+// keeps a single change, from its definition before n to its definition
+// after later, and only the later status is kept.
+func (n *notification) merge(later notification) {
+	n.changes = mergeChanges(n.changes, later.changes)
+	if later.status != nil {
+		n.status = later.status
+	}
+}
+
+// mergeChanges combines two lists of changes ordered by name, the second
+// made after the first. Flags that end up as they started are dropped.
+func mergeChanges(first, second []flagChange) []flagChange {
+	if len(first) == 0 {
+		return second
+	}
+	if len(second) == 0 {
+		return first
+	}
+
+	merged := make([]flagChange, 0, len(first)+len(second))
+	i, j := 0, 0
+	for i < len(first) || j < len(second) {
+		switch {
+		case j == len(second) || (i < len(first) && first[i].name < second[j].name):
+			merged = append(merged, first[i])
+			i++
+		case i == len(first) || second[j].name < first[i].name:
+			merged = append(merged, second[j])
+			j++
+		default:
+			change := flagChange{name: first[i].name, old: first[i].old, new: second[j].new}
+			i++
+			j++
+			if change.old == nil && change.new == nil {
+				continue
+			}
+			if change.old != nil && change.new != nil && change.old.Equal(change.new) {
+				continue
+			}
+			merged = append(merged, change)
+		}
+	}
+	return merged
+}
+
+// notifier delivers flag changes and statuses to subscriptions, in order,
+// from its own goroutine. Notifications that haven't been delivered yet are
+// merged, so that a slow subscription delays them rather than letting them
+// pile up. It also tells watchers when the default tags or runtime overrides
+// change.
+type notifier struct {
+	mu         sync.Mutex
+	subs       map[uint64]*subscription
+	statusSubs map[uint64]StatusFunc
+	watchers   map[uint64]func()
+	nextID     uint64
+	pending    *notification
+
+	// wake has a buffer of one, so that notify never blocks
+	wake chan struct{}
+}
+
+func newNotifier() *notifier {
+	return &notifier{
+		subs:       make(map[uint64]*subscription),
+		statusSubs: make(map[uint64]StatusFunc),
+		watchers:   make(map[uint64]func()),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+func (n *notifier) subscribe(name string, fn ChangeFunc) (unsubscribe func()) {
+	return n.add(newSubscription(name, fn, nil))
+}
+
+func (n *notifier) subscribeBatch(name string, fn BatchFunc) (unsubscribe func()) {
+	return n.add(newSubscription(name, nil, fn))
+}
+
+func newSubscription(name string, fn ChangeFunc, batch BatchFunc) *subscription {
+	sub := &subscription{name: name, fn: fn, batch: batch}
+	if strings.HasSuffix(name, "*") {
+		sub.name = strings.TrimSuffix(name, "*")
+		sub.prefix = true
+	}
+	return sub
+}
+
+func (n *notifier) add(sub *subscription) (unsubscribe func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	id := n.nextID
+	n.nextID++
+	n.subs[id] = sub
+
+	return func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.subs, id)
+	}
+}
+
+func (n *notifier) subscribeStatus(fn StatusFunc) (unsubscribe func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	id := n.nextID
+	n.nextID++
+	n.statusSubs[id] = fn
+
+	return func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.statusSubs, id)
+	}
+}
+
+// notify queues changes for delivery, followed by the status returned by
+// status if anything is subscribed to it. status may be nil if the status
+// isn't needed, such as when loading bootstrap flags.
+func (n *notifier) notify(changes []flagChange, status func() Status) {
+	var note notification
+
+	n.mu.Lock()
+	if len(n.subs) > 0 {
+		note.changes = changes
+	}
+	if len(n.statusSubs) > 0 && status != nil {
+		s := status()
+		note.status = &s
+	}
+	if len(note.changes) == 0 && note.status == nil {
+		n.mu.Unlock()
+		return
+	}
+	if n.pending == nil {
+		n.pending = &note
+	} else {
+		n.pending.merge(note)
+	}
+	n.mu.Unlock()
+
+	select {
+	case n.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers queued changes until ctx is done.
+func (n *notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.wake:
+		}
+
+		for {
+			n.mu.Lock()
+			if n.pending == nil {
+				n.mu.Unlock()
+				break
+			}
+			note := *n.pending
+			n.pending = nil
+			subs := make([]*subscription, 0, len(n.subs))
+			for _, sub := range n.subs {
+				subs = append(subs, sub)
+			}
+			statusSubs := make([]StatusFunc, 0, len(n.statusSubs))
+			for _, fn := range n.statusSubs {
+				statusSubs = append(statusSubs, fn)
+			}
+			n.mu.Unlock()
+
+			for _, sub := range subs {
+				sub.deliver(note.changes)
+			}
+			if note.status != nil {
+				for _, fn := range statusSubs {
+					fn(*note.status)
+				}
+			}
+		}
+	}
+}
+
+// Subscriber is implemented by the Goforit returned by New, to react to flags
+// changing.
+type Subscriber interface {
+	Subscribe(name string, fn ChangeFunc) (unsubscribe func())
+	SubscribeBatch(name string, fn BatchFunc) (unsubscribe func())
+	SubscribeStatus(fn StatusFunc) (unsubscribe func())
+	Watch(ctx context.Context, name string, props map[string]string) <-chan bool
+}
+
+// Subscribe registers fn to be called when the flag with the given name is
+// added, removed or redefined. If name ends with "*", fn is called for every
+// flag whose name starts with the rest of it, so "*" alone matches all flags.
+// Changes are delivered asynchronously after each refresh, one at a time and
+// in order. If subscriptions fall behind, the changes made by several
+// refreshes are combined, so that each flag changes from the definition last
+// passed to fn to its current one. The returned function cancels the subscription.
+func (g *goforit) Subscribe(name string, fn ChangeFunc) (unsubscribe func()) {
+	return g.notifier.subscribe(name, fn)
+}
+
+// SubscribeBatch is like Subscribe, but fn is called once per refresh with
+// all the matching changes it made, rather than once per change.
+func (g *goforit) SubscribeBatch(name string, fn BatchFunc) (unsubscribe func()) {
+	return g.notifier.subscribeBatch(name, fn)
+}
+
+// SubscribeStatus registers fn to be called with the status after each
+// refresh, whether or not it succeeded. Statuses are delivered
+// asynchronously, in order, after the changes made by the same refresh. If
+// subscriptions fall behind, only the latest status is delivered. The returned function
+// cancels the subscription.
+func (g *goforit) SubscribeStatus(fn StatusFunc) (unsubscribe func()) {
+	return g.notifier.subscribeStatus(fn)
+}
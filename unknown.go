@@ -0,0 +1,129 @@
+package goforit
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	unknownDroppedMetricName = "goforit.flags.unknown_dropped"
+
+	// DefaultMaxUnknownFlags is the default number of distinct unknown flag
+	// names counted between calls to ReportUnknownCounts.
+	DefaultMaxUnknownFlags = 1000
+)
+
+// UnknownFlagCallback registers a callback to execute when a flag that isn't
+// defined is evaluated, once the backend has refreshed successfully. This is
+// usually a typo, or a flag that was deleted before the code using it. The
+// callback is called the first time each name is counted since the last call
+// to ReportUnknownCounts, so not for names beyond MaxUnknownFlags.
+func UnknownFlagCallback(cb func(flag string)) Option {
+	return optionFunc(func(g *goforit) {
+		g.unknown.cb = cb
+	})
+}
+
+// MaxUnknownFlags bounds the number of distinct unknown flag names counted
+// between calls to ReportUnknownCounts. Evaluations of further names are only
+// counted in the goforit.flags.unknown_dropped metric. The default is
+// DefaultMaxUnknownFlags.
+func MaxUnknownFlags(n int) Option {
+	return optionFunc(func(g *goforit) {
+		g.unknown.max = n
+	})
+}
+
+// unknownFlags counts evaluations of flags that aren't defined. Counting a
+// name that has been seen before is lock-free; mu is only held to add names,
+// so that at most max are counted.
+type unknownFlags struct {
+	cb  func(flag string)
+	max int
+
+	// counts maps names to *atomic.Uint64
+	counts sync.Map
+	// full is set once max names are counted, so further names are dropped
+	// without taking mu
+	full atomic.Bool
+
+	mu   sync.Mutex
+	size int
+}
+
+func (u *unknownFlags) add(name string) (dropped bool) {
+	if c, ok := u.counts.Load(name); ok {
+		c.(*atomic.Uint64).Add(1)
+		return false
+	}
+	return u.insert(name)
+}
+
+//go:noinline
+func (u *unknownFlags) insert(name string) (dropped bool) {
+	if u.full.Load() {
+		return true
+	}
+
+	u.mu.Lock()
+	c, loaded := u.counts.Load(name)
+	if !loaded {
+		if u.size >= u.max {
+			u.full.Store(true)
+			u.mu.Unlock()
+			return true
+		}
+		c = new(atomic.Uint64)
+		u.counts.Store(name, c)
+		u.size++
+	}
+	u.mu.Unlock()
+
+	c.(*atomic.Uint64).Add(1)
+	if !loaded && u.cb != nil {
+		u.cb(name)
+	}
+	return false
+}
+
+// take returns the counts and resets them. Evaluations that race with it may
+// not be counted.
+func (u *unknownFlags) take() map[string]uint64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var counts map[string]uint64
+	u.counts.Range(func(key, value interface{}) bool {
+		u.counts.Delete(key)
+		if counts == nil {
+			counts = make(map[string]uint64)
+		}
+		counts[key.(string)] = value.(*atomic.Uint64).Swap(0)
+		return true
+	})
+	u.size = 0
+	u.full.Store(false)
+	return counts
+}
+
+// countUnknown records an evaluation of a flag that isn't defined. Nothing is
+// counted before the backend first refreshes successfully, since flags that
+// only it defines are unknown until then.
+//
+//go:noinline
+func (g *goforit) countUnknown(name string) {
+	if !g.refreshed.Load() {
+		return
+	}
+	if g.unknown.add(name) {
+		_ = g.getStats().Count(unknownDroppedMetricName, 1, nil, 1)
+	}
+}
+
+// ReportUnknownCounts calls callback with the number of times each flag that
+// isn't defined was evaluated since the last call, and resets the counts.
+func (g *goforit) ReportUnknownCounts(callback func(name string, count uint64)) {
+	for name, count := range g.unknown.take() {
+		callback(name, count)
+	}
+}
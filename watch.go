@@ -0,0 +1,97 @@
+package goforit
+
+import (
+	"context"
+
+	"github.com/stripe/goforit/flags2"
+)
+
+// watch registers poke to be called whenever the default tags or runtime
+// overrides change, which can change any flag's value. poke must not block.
+func (n *notifier) watch(poke func()) (unwatch func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	id := n.nextID
+	n.nextID++
+	n.watchers[id] = poke
+
+	return func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.watchers, id)
+	}
+}
+
+func (n *notifier) tagsChanged() {
+	n.pokeWatchers()
+}
+
+// overridesChanged is called when a runtime override is set, cleared or
+// expires.
+func (n *notifier) overridesChanged() {
+	n.pokeWatchers()
+}
+
+func (n *notifier) pokeWatchers() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, poke := range n.watchers {
+		poke()
+	}
+}
+
+// Watch evaluates a flag with fixed properties, and sends its value on the
+// returned channel: first its current value, and then its new value each
+// time it changes. The flag is only re-evaluated when its definition, the
+// default tags or the runtime overrides change, so rules that hash by
+// "_random" are not re-rolled in between.
+//
+// The channel is closed once ctx is done, or Goforit is closed. Overrides in
+// ctx apply as they would to Enabled.
+func (g *goforit) Watch(ctx context.Context, name string, properties map[string]string) <-chan bool {
+	props := make(map[string]string, len(properties))
+	for k, v := range properties {
+		props[k] = v
+	}
+
+	ch := make(chan bool)
+	trigger := make(chan struct{}, 1)
+	poke := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	unsubscribe := g.Subscribe(name, func(old, new *flags2.Flag2) { poke() })
+	unwatch := g.notifier.watch(poke)
+
+	go func() {
+		defer close(ch)
+		defer unsubscribe()
+		defer unwatch()
+
+		last, sent := false, false
+		for {
+			if value := g.Enabled(ctx, name, props); !sent || value != last {
+				select {
+				case ch <- value:
+				case <-ctx.Done():
+					return
+				case <-g.ctx.Done():
+					return
+				}
+				last, sent = value, true
+			}
+
+			select {
+			case <-trigger:
+			case <-ctx.Done():
+				return
+			case <-g.ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}